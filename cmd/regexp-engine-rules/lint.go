@@ -0,0 +1,101 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+)
+
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	skip := flags.String("skip", "", "comma-separated checks not to report, of: "+strings.Join(processor.LintChecks, ", "))
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "No config given, name task manifests or rules files to lint")
+		return 2
+	}
+	skipped, err := parseChecks(*skip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var reported int
+	for _, path := range flags.Args() {
+		cfg, err := loadConfig(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		findings, err := processor.Lint(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+			return 1
+		}
+		reported += reportFindings(os.Stdout, path, findings, skipped)
+	}
+
+	if reported > 0 {
+		fmt.Printf("%d findings\n", reported)
+		return 1
+	}
+	return 0
+}
+
+// parseChecks parses a comma-separated list of checks
+func parseChecks(list string) (map[string]bool, error) {
+	known := make(map[string]bool, len(processor.LintChecks))
+	for _, check := range processor.LintChecks {
+		known[check] = true
+	}
+	checks := make(map[string]bool)
+	for _, check := range strings.Split(list, ",") {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		if !known[check] {
+			return nil, fmt.Errorf("Unknown check %q, must be one of %v", check, strings.Join(processor.LintChecks, ", "))
+		}
+		checks[check] = true
+	}
+	return checks, nil
+}
+
+// reportFindings prints the findings that aren't skipped, returning
+// how many it printed
+func reportFindings(w io.Writer, path string, findings []processor.LintFinding, skipped map[string]bool) int {
+	var reported int
+	for _, finding := range findings {
+		if skipped[finding.Check] {
+			continue
+		}
+		reported++
+		fmt.Fprintf(w, "%v: %v: %v: %v\n", path, finding.Gate, finding.Check, finding.Message)
+	}
+	return reported
+}
@@ -0,0 +1,48 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReportFindings(t *testing.T) {
+	Convey("Test reporting lint findings", t, func() {
+		findings := []processor.LintFinding{
+			{Gate: "requests", Check: processor.LintUnanchored, Message: "Regex starts with neither an anchor nor a literal"},
+			{Gate: "requests", Check: processor.LintUnknownTag, Message: "Template uses tag \"nope\""},
+		}
+
+		skipped, err := parseChecks("unknown_tag, ")
+		So(err, ShouldBeNil)
+		var out bytes.Buffer
+		So(reportFindings(&out, "rules.yaml", findings, skipped), ShouldEqual, 1)
+		So(out.String(), ShouldEqual, "rules.yaml: requests: unanchored: Regex starts with neither an anchor nor a literal\n")
+
+		_, err = parseChecks("nope")
+		So(err, ShouldNotBeNil)
+	})
+}
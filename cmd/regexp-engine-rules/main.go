@@ -0,0 +1,76 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// regexp-engine-rules works with the plugin's rules outside of Snap
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+)
+
+const usage = `Usage: regexp-engine-rules <command> [options] [file...]
+
+Commands:
+  run    process lines or metrics with a config, printing the result as JSON
+  test   run the tests declared alongside the gates of configs
+  lint   report likely mistakes in the gates of configs
+
+Run "regexp-engine-rules <command> -h" for a command's options.
+`
+
+// commands are the subcommands by name; each returns the exit status
+var commands = map[string]func(args []string) int{
+	"run":  run,
+	"test": runTests,
+	"lint": lint,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%v", os.Args[1], usage)
+		os.Exit(2)
+	}
+	os.Exit(command(os.Args[2:]))
+}
+
+// loadConfig reads the plugin's config from a task manifest or rules file
+func loadConfig(path string) (plugin.Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("No config given, use -config")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := processor.LoadConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load %v: %v", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,229 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+)
+
+const (
+	inputLines = "lines"
+	inputJSON  = "json"
+
+	// maxLineSize is the longest line read, as log lines can be long
+	maxLineSize = 16 * 1024 * 1024
+)
+
+// jsonMetric is a metric as read and printed, in the shape
+// Snap's file publisher writes
+type jsonMetric struct {
+	Namespace string            `json:"namespace"`
+	Data      interface{}       `json:"data"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", "", "task manifest or rules file to load the config from")
+	input := flags.String("input", inputLines, "input format: lines, each the data of a metric, or json metrics")
+	namespace := flags.String("namespace", "/intel/logs/message", "namespace of the metrics read from lines")
+	trace := flags.Bool("trace", false, "log a trace of each stage to stderr, as the debug config does")
+	flags.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *trace {
+		if _, ok := cfg["debug"]; !ok {
+			cfg["debug"] = true
+		}
+	}
+	log.SetOutput(os.Stderr)
+
+	var mts []plugin.Metric
+	err = eachInput(flags.Args(), func(r io.Reader) error {
+		var read []plugin.Metric
+		var err error
+		switch *input {
+		case inputLines:
+			read, err = readLines(r, *namespace)
+		case inputJSON:
+			read, err = readJSON(r)
+		default:
+			err = fmt.Errorf("Input must be %v or %v, not %q", inputLines, inputJSON, *input)
+		}
+		mts = append(mts, read...)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := processor.New()
+	processed, err := p.Process(mts, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The input has ended, so nothing more is coming
+	// to close the windows of what was held back
+	flushed, err := p.Flush(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	processed = append(processed, flushed...)
+	err = writeJSON(os.Stdout, processed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// eachInput calls read with each of the files, or stdin if there are none
+func eachInput(paths []string, read func(io.Reader) error) error {
+	if len(paths) == 0 {
+		return read(os.Stdin)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = read(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// readLines reads a metric from each line that isn't empty
+func readLines(r io.Reader, namespace string) ([]plugin.Metric, error) {
+	var mts []plugin.Metric
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	now := time.Now()
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		mts = append(mts, plugin.Metric{
+			Namespace: splitNamespace(namespace),
+			Timestamp: now,
+			Tags:      map[string]string{},
+			Data:      line,
+		})
+	}
+	return mts, scanner.Err()
+}
+
+// readJSON reads metrics given as JSON objects, or lists of them
+func readJSON(r io.Reader) ([]plugin.Metric, error) {
+	var mts []plugin.Metric
+	decoder := json.NewDecoder(r)
+	now := time.Now()
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return mts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var read []jsonMetric
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+			err = json.Unmarshal(raw, &read)
+		} else {
+			read = make([]jsonMetric, 1)
+			err = json.Unmarshal(raw, &read[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range read {
+			mts = append(mts, m.metric(now))
+		}
+	}
+}
+
+// writeJSON prints the metrics as an indented JSON list
+func writeJSON(w io.Writer, mts []plugin.Metric) error {
+	out := make([]jsonMetric, 0, len(mts))
+	for _, m := range mts {
+		out = append(out, jsonMetric{
+			Namespace: "/" + strings.Join(m.Namespace.Strings(), "/"),
+			Data:      m.Data,
+			Tags:      m.Tags,
+			Unit:      m.Unit,
+			Timestamp: m.Timestamp,
+		})
+	}
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", encoded)
+	return err
+}
+
+// metric returns the plugin metric, timestamped now if it has no
+// timestamp of its own
+func (m jsonMetric) metric(now time.Time) plugin.Metric {
+	if m.Timestamp.IsZero() {
+		m.Timestamp = now
+	}
+	if m.Tags == nil {
+		m.Tags = map[string]string{}
+	}
+	return plugin.Metric{
+		Namespace: splitNamespace(m.Namespace),
+		Timestamp: m.Timestamp,
+		Tags:      m.Tags,
+		Data:      m.Data,
+		Unit:      m.Unit,
+	}
+}
+
+// splitNamespace splits a "/a/b" namespace into its elements
+func splitNamespace(namespace string) plugin.Namespace {
+	return plugin.NewNamespace(strings.Split(strings.Trim(namespace, "/"), "/")...)
+}
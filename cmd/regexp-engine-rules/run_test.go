@@ -0,0 +1,90 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadInput(t *testing.T) {
+	Convey("Test reading input", t, func() {
+		Convey("as lines", func() {
+			mts, err := readLines(strings.NewReader("GET /a 200\n\nGET /b 500\n"), "/intel/logs/access")
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 2)
+			So(mts[1].Data, ShouldEqual, "GET /b 500")
+			So(mts[1].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "access"})
+			So(mts[1].Tags, ShouldNotBeNil)
+		})
+
+		Convey("as JSON metrics and lists of them", func() {
+			mts, err := readJSON(strings.NewReader(`
+{"namespace": "/intel/logs/a", "data": "one", "tags": {"host": "x"}}
+[{"namespace": "/intel/logs/b", "data": "two", "timestamp": "2017-01-02T03:04:05Z"},
+ {"namespace": "/intel/logs/c", "data": 3}]
+`))
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 3)
+			So(mts[0].Tags, ShouldResemble, map[string]string{"host": "x"})
+			So(mts[1].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "b"})
+			So(mts[1].Timestamp.Year(), ShouldEqual, 2017)
+			So(mts[2].Data, ShouldEqual, 3)
+			So(mts[2].Timestamp.IsZero(), ShouldBeFalse)
+
+			_, err = readJSON(strings.NewReader(`{"namespace": `))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWriteJSON(t *testing.T) {
+	Convey("Test writing metrics as JSON", t, func() {
+		var out bytes.Buffer
+		err := writeJSON(&out, []plugin.Metric{{
+			Namespace: plugin.NewNamespace("intel", "logs", "message"),
+			Timestamp: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+			Tags:      map[string]string{"status": "200"},
+			Data:      "GET /a 200",
+		}})
+		So(err, ShouldBeNil)
+
+		var written []map[string]interface{}
+		So(json.Unmarshal(out.Bytes(), &written), ShouldBeNil)
+		So(written, ShouldResemble, []map[string]interface{}{{
+			"namespace": "/intel/logs/message",
+			"data":      "GET /a 200",
+			"tags":      map[string]interface{}{"status": "200"},
+			"timestamp": "2017-01-02T03:04:05Z",
+		}})
+
+		out.Reset()
+		So(writeJSON(&out, nil), ShouldBeNil)
+		So(out.String(), ShouldEqual, "[]\n")
+	})
+}
@@ -0,0 +1,83 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+)
+
+func runTests(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "list the tests that pass too")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "No config given, name task manifests or rules files to test")
+		return 2
+	}
+
+	var total, failed int
+	for _, path := range flags.Args() {
+		cfg, err := loadConfig(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		results, err := processor.RunRuleTests(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+			return 1
+		}
+		total += len(results)
+		failed += reportTests(os.Stdout, path, results, *verbose)
+	}
+
+	fmt.Printf("%d tests, %d failed\n", total, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportTests prints the failed tests, and the passed ones if verbose,
+// returning how many failed
+func reportTests(w io.Writer, path string, results []processor.RuleTestResult, verbose bool) int {
+	var failed int
+	for _, result := range results {
+		if result.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "ok   %v: %v: %v\n", path, result.Gate, result.Name)
+			}
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL %v: %v: %v\n", path, result.Gate, result.Name)
+		for _, diff := range result.Diffs {
+			fmt.Fprintf(w, "    %v\n", strings.Replace(diff, "\n", "\n    ", -1))
+		}
+	}
+	return failed
+}
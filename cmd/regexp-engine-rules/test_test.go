@@ -0,0 +1,55 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/signifai/snap-plugin-processor-regexp-engine/processor"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReportTests(t *testing.T) {
+	Convey("Test reporting rule tests", t, func() {
+		results := []processor.RuleTestResult{
+			{Gate: "requests", Name: "ok"},
+			{Gate: "requests", Name: "bad", Diffs: []string{
+				"count: expected 2 metrics, got 1",
+				"metric 1 tags:\n  - status: \"201\"\n  + status: \"200\"",
+			}},
+		}
+
+		var out bytes.Buffer
+		So(reportTests(&out, "rules.yaml", results, false), ShouldEqual, 1)
+		So(out.String(), ShouldEqual, `FAIL rules.yaml: requests: bad
+    count: expected 2 metrics, got 1
+    metric 1 tags:
+      - status: "201"
+      + status: "200"
+`)
+
+		out.Reset()
+		So(reportTests(&out, "rules.yaml", results, true), ShouldEqual, 1)
+		So(out.String(), ShouldStartWith, "ok   rules.yaml: requests: ok\nFAIL")
+	})
+}
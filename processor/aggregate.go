@@ -0,0 +1,337 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configAggregateValue     = "value"
+	configAggregateBy        = "by"
+	configAggregateStats     = "stats"
+	configAggregateInterval  = "interval"
+	configAggregateNamespace = "namespace"
+	configAggregateReplace   = "replace"
+
+	// Statistics an aggregate can emit
+	aggregateCount = "count"
+	aggregateSum   = "sum"
+	aggregateMin   = "min"
+	aggregateMax   = "max"
+	aggregateMean  = "mean"
+	aggregateP50   = "p50"
+	aggregateP90   = "p90"
+	aggregateP99   = "p99"
+
+	defaultAggregateInterval = time.Minute
+
+	// maxAggregateSamples bounds the values kept for percentiles
+	// per group and interval; beyond it they're sampled
+	maxAggregateSamples = 10000
+)
+
+var aggregateStats = []string{aggregateCount, aggregateSum, aggregateMin, aggregateMax, aggregateMean, aggregateP50, aggregateP90, aggregateP99}
+
+var aggregatePercentiles = map[string]float64{
+	aggregateP50: 50,
+	aggregateP90: 90,
+	aggregateP99: 99,
+}
+
+// gateAggregate aggregates the numbers in the Value tag of the
+// metrics a gate emits, grouped by the By tags, over each Interval
+type gateAggregate struct {
+	Value     string
+	By        []string
+	Stats     []string
+	Interval  time.Duration
+	Namespace []string
+	// Replace drops the aggregated metrics
+	Replace bool
+}
+
+// aggregator holds the aggregates between Process calls
+type aggregator struct {
+	sync.Mutex
+	groups map[string]*aggregateGroup
+	// order keeps the groups in the order first seen
+	order []string
+}
+
+// aggregateGroup holds the values of one group in the
+// current interval
+type aggregateGroup struct {
+	// config is the ID of the config the group belongs to
+	config   string
+	settings *gateAggregate
+	tags     map[string]string
+	end      time.Time
+
+	count   int64
+	sum     float64
+	min     float64
+	max     float64
+	samples []float64
+	rng     *rand.Rand
+}
+
+func compileGateAggregate(from interface{}) (*gateAggregate, error) {
+	rawCfg, ok := from.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a dict, not a %T", configAggregate, from)
+	}
+
+	a := &gateAggregate{
+		Stats:    aggregateStats,
+		Interval: defaultAggregateInterval,
+		Replace:  true,
+	}
+
+	a.Value, _ = rawCfg[configAggregateValue].(string)
+	if a.Value == "" {
+		return nil, fmt.Errorf("%v needs a %v tag", configAggregate, configAggregateValue)
+	}
+	a.Namespace = []string{Name, configAggregate, a.Value}
+
+	if iBy, ok := rawCfg[configAggregateBy]; ok {
+		by, err := compileStringList(iBy)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v: %v", configAggregate, configAggregateBy, err)
+		}
+		a.By = by
+	}
+
+	if iStats, ok := rawCfg[configAggregateStats]; ok {
+		stats, err := compileStringList(iStats)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v: %v", configAggregate, configAggregateStats, err)
+		}
+		for _, stat := range stats {
+			if !isAggregateStat(stat) {
+				return nil, fmt.Errorf("%v %v must be some of %v, not %v", configAggregate, configAggregateStats, aggregateStats, stat)
+			}
+		}
+		a.Stats = stats
+	}
+
+	if iInterval, ok := rawCfg[configAggregateInterval]; ok {
+		var err error
+		a.Interval, err = configDuration(iInterval)
+		if err != nil || a.Interval <= 0 {
+			return nil, fmt.Errorf("%v %v must be a positive duration, not %v", configAggregate, configAggregateInterval, iInterval)
+		}
+	}
+
+	if iNamespace, ok := rawCfg[configAggregateNamespace]; ok {
+		namespace, err := compileNamespace(iNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("%v %v: %v", configAggregate, configAggregateNamespace, err)
+		}
+		a.Namespace = namespace
+	}
+
+	if iReplace, ok := rawCfg[configAggregateReplace]; ok {
+		a.Replace, ok = iReplace.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v %v must be true or false, not %v", configAggregate, configAggregateReplace, iReplace)
+		}
+	}
+
+	return a, nil
+}
+
+func isAggregateStat(stat string) bool {
+	for _, aggregateStat := range aggregateStats {
+		if stat == aggregateStat {
+			return true
+		}
+	}
+	return false
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{groups: make(map[string]*aggregateGroup)}
+}
+
+// add aggregates the value of a metric emitted by a gate
+// of the config with the given ID
+func (a *aggregator) add(configID string, gate internalConfig, m plugin.Metric, now time.Time) {
+	settings := gate.Aggregate
+	rawValue, ok := m.Tags[settings.Value]
+	if !ok {
+		return
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(rawValue), 64)
+	if err != nil || math.IsNaN(value) {
+		warnFields := map[string]interface{}{
+			"namespace": m.Namespace.Strings(),
+			"gate":      gate.Name,
+			"tag":       settings.Value,
+			"value":     rawValue,
+		}
+		log.WithFields(warnFields).Debug("Not aggregating a value that isn't a number")
+		return
+	}
+
+	tags := map[string]string{counterGateTag: gate.Name}
+	key := []string{configID, gate.Name, settings.Value}
+	for _, tag := range settings.By {
+		value, ok := m.Tags[tag]
+		if ok {
+			tags[tag] = value
+		}
+		key = append(key, fmt.Sprintf("%v:%q", ok, value))
+	}
+	id := strings.Join(key, "\x00")
+
+	a.Lock()
+	defer a.Unlock()
+
+	group, ok := a.groups[id]
+	if !ok {
+		group = &aggregateGroup{
+			config: configID,
+			tags:   tags,
+			end:    now.Truncate(settings.Interval).Add(settings.Interval),
+			rng:    rand.New(rand.NewSource(now.UnixNano())),
+		}
+		a.groups[id] = group
+		a.order = append(a.order, id)
+	}
+	// The latest config wins
+	group.settings = settings
+	group.add(value)
+}
+
+func (g *aggregateGroup) add(value float64) {
+	if g.count == 0 || value < g.min {
+		g.min = value
+	}
+	if g.count == 0 || value > g.max {
+		g.max = value
+	}
+	g.count++
+	g.sum += value
+
+	if len(g.samples) < maxAggregateSamples {
+		g.samples = append(g.samples, value)
+		return
+	}
+	// Reservoir sampling keeps every value
+	// equally likely to be a sample
+	if idx := g.rng.Int63n(g.count); idx < maxAggregateSamples {
+		g.samples[idx] = value
+	}
+}
+
+// flush returns the metrics of the config's groups whose
+// interval has ended, and forgets them
+func (a *aggregator) flush(configID string, now time.Time) []plugin.Metric {
+	return a.flushGroups(configID, func(group *aggregateGroup) bool {
+		return !now.Before(group.end)
+	})
+}
+
+// drain returns the metrics of all the config's groups, whether
+// or not their interval has ended, and forgets them
+func (a *aggregator) drain(configID string) []plugin.Metric {
+	return a.flushGroups(configID, func(*aggregateGroup) bool {
+		return true
+	})
+}
+
+// flushGroups returns the metrics of the config's groups that
+// are due, and forgets them
+func (a *aggregator) flushGroups(configID string, due func(*aggregateGroup) bool) []plugin.Metric {
+	a.Lock()
+	defer a.Unlock()
+
+	var mts []plugin.Metric
+	var kept []string
+	for _, id := range a.order {
+		group := a.groups[id]
+		if group.config != configID || !due(group) {
+			kept = append(kept, id)
+			continue
+		}
+		mts = append(mts, group.metrics()...)
+		delete(a.groups, id)
+	}
+	a.order = kept
+	return mts
+}
+
+// metrics returns a metric for each of the group's statistics
+func (g *aggregateGroup) metrics() []plugin.Metric {
+	sort.Float64s(g.samples)
+
+	var mts []plugin.Metric
+	for _, stat := range g.settings.Stats {
+		var data interface{}
+		switch stat {
+		case aggregateCount:
+			data = g.count
+		case aggregateSum:
+			data = g.sum
+		case aggregateMin:
+			data = g.min
+		case aggregateMax:
+			data = g.max
+		case aggregateMean:
+			data = g.sum / float64(g.count)
+		default:
+			data = percentile(g.samples, aggregatePercentiles[stat])
+		}
+		namespace := append(append([]string{}, g.settings.Namespace...), stat)
+		tags := make(map[string]string, len(g.tags))
+		for tag, value := range g.tags {
+			tags[tag] = value
+		}
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace(namespace...),
+			Timestamp: g.end,
+			Tags:      tags,
+			Data:      data,
+		})
+	}
+	return mts
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
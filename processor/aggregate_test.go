@@ -0,0 +1,140 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAggregation(t *testing.T) {
+	Convey("Test percentiles", t, func() {
+		values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+		So(percentile(values, 50), ShouldEqual, 5)
+		So(percentile(values, 90), ShouldEqual, 9)
+		So(percentile(values, 99), ShouldEqual, 10)
+		So(percentile(nil, 50), ShouldEqual, 0)
+	})
+
+	Convey("Test aggregating values over an interval", t, func() {
+		settings, err := compileGateAggregate(map[interface{}]interface{}{
+			configAggregateValue:    "latency",
+			configAggregateBy:       []interface{}{"service"},
+			configAggregateStats:    []interface{}{aggregateCount, aggregateSum, aggregateMin, aggregateMax, aggregateMean, aggregateP90},
+			configAggregateInterval: "1m",
+		})
+		So(err, ShouldBeNil)
+		So(settings.Namespace, ShouldResemble, []string{Name, configAggregate, "latency"})
+		gate := internalConfig{Name: "latency", Aggregate: settings}
+
+		start := time.Date(2017, 5, 1, 12, 0, 10, 0, time.UTC)
+		a := newAggregator()
+		for i := 1; i <= 10; i++ {
+			a.add("task", gate, plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Tags:      map[string]string{"service": "api", "latency": fmt.Sprint(i * 10)},
+			}, start)
+		}
+		a.add("task", gate, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Tags:      map[string]string{"service": "web", "latency": "n/a"},
+		}, start)
+
+		So(a.flush("task", start.Add(30*time.Second)), ShouldBeEmpty)
+
+		metrics := a.flush("task", start.Add(50 * time.Second))
+		So(len(metrics), ShouldEqual, 6)
+		data := map[string]interface{}{}
+		for _, m := range metrics {
+			So(m.Timestamp, ShouldResemble, time.Date(2017, 5, 1, 12, 1, 0, 0, time.UTC))
+			So(m.Tags, ShouldResemble, map[string]string{counterGateTag: "latency", "service": "api"})
+			ns := m.Namespace.Strings()
+			data[ns[len(ns)-1]] = m.Data
+		}
+		So(data, ShouldResemble, map[string]interface{}{
+			aggregateCount: int64(10),
+			aggregateSum:   550.0,
+			aggregateMin:   10.0,
+			aggregateMax:   100.0,
+			aggregateMean:  55.0,
+			aggregateP90:   90.0,
+		})
+
+		So(a.flush("task", start.Add(10*time.Minute)), ShouldBeEmpty)
+	})
+
+	Convey("Test bad aggregate configs are rejected", t, func() {
+		_, err := compileGateAggregate(map[interface{}]interface{}{})
+		So(err, ShouldNotBeNil)
+		_, err = compileGateAggregate(map[interface{}]interface{}{configAggregateValue: "x", configAggregateStats: []interface{}{"p75"}})
+		So(err, ShouldNotBeNil)
+		_, err = compileGateAggregate(map[interface{}]interface{}{configAggregateValue: "x", configAggregateInterval: "0s"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test aggregation in Process", t, func() {
+		config := plugin.Config{
+			"took": `{parse: ['took (?P<ms>[0-9.]+)ms'], aggregate: {value: ms, stats: [max], interval: 1ns, namespace: /intel/logs/took}}`,
+		}
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "request took 12.5ms",
+			},
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldBeEmpty)
+
+		time.Sleep(time.Millisecond)
+		metrics, err = newPlugin.Process(nil, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "took", aggregateMax})
+		So(metrics[0].Data, ShouldEqual, 12.5)
+
+		Convey("keeping each task's groups to itself", func() {
+			other := plugin.Config{
+				"took": `{parse: ['took (?P<ms>[0-9.]+)ms'], aggregate: {value: ms, stats: [max], interval: 1ns, namespace: /intel/logs/elsewhere}}`,
+			}
+			metrics, err := newPlugin.Process(mts, config)
+			So(err, ShouldBeNil)
+			So(metrics, ShouldBeEmpty)
+
+			time.Sleep(time.Millisecond)
+			metrics, err = newPlugin.Process(nil, other)
+			So(err, ShouldBeNil)
+			So(metrics, ShouldBeEmpty)
+
+			metrics, err = newPlugin.Process(nil, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "took", aggregateMax})
+		})
+	})
+}
@@ -0,0 +1,218 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configCardinalityLimits      = "limits"
+	configCardinalityWindow      = "window"
+	configCardinalityPlaceholder = "placeholder"
+
+	defaultCardinalityWindow      = time.Hour
+	defaultCardinalityPlaceholder = "__overflow__"
+)
+
+// cardinalityGuard limits how many distinct values each of some
+// tags may have within a window
+type cardinalityGuard struct {
+	Limits      map[string]int
+	Window      time.Duration
+	Placeholder string
+}
+
+// cardinalityTracker remembers the values of the guarded tags
+// between Process calls, by config ID then tag
+type cardinalityTracker struct {
+	sync.Mutex
+	configs map[string]map[string]*trackedValues
+}
+
+type trackedValues struct {
+	// lastSeen is when each value was last seen
+	lastSeen map[string]time.Time
+	// oldest is no later than the earliest lastSeen,
+	// so values can't expire before then
+	oldest time.Time
+	// overflows counts the values replaced
+	overflows uint64
+	// overflowing is set from the first value replaced
+	// until a value expires, so we only log once
+	overflowing bool
+}
+
+func compileCardinalityGuard(from interface{}) (*cardinalityGuard, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be a dict, not a %T", decoded)
+	}
+
+	g := &cardinalityGuard{
+		Limits:      make(map[string]int),
+		Window:      defaultCardinalityWindow,
+		Placeholder: defaultCardinalityPlaceholder,
+	}
+
+	rawLimits, ok := rawCfg[configCardinalityLimits].(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a dict of tags to limits, not a %T", configCardinalityLimits, rawCfg[configCardinalityLimits])
+	}
+	for iTag, iLimit := range rawLimits {
+		tag, ok := iTag.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v tag not a string but %T with value %v", configCardinalityLimits, iTag, iTag)
+		}
+		limit, err := configInt(iLimit)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("%v of %v must be a positive number, not %v", configCardinalityLimits, tag, iLimit)
+		}
+		g.Limits[tag] = limit
+	}
+
+	if iWindow, ok := rawCfg[configCardinalityWindow]; ok {
+		g.Window, err = configDuration(iWindow)
+		if err != nil || g.Window <= 0 {
+			return nil, fmt.Errorf("%v must be a positive duration, not %v", configCardinalityWindow, iWindow)
+		}
+	}
+
+	if iPlaceholder, ok := rawCfg[configCardinalityPlaceholder]; ok {
+		g.Placeholder, ok = iPlaceholder.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a string, not a %T", configCardinalityPlaceholder, iPlaceholder)
+		}
+	}
+
+	return g, nil
+}
+
+func newCardinalityTracker() *cardinalityTracker {
+	return &cardinalityTracker{configs: make(map[string]map[string]*trackedValues)}
+}
+
+// guard replaces the values of guarded tags beyond their limits
+// with the placeholder, counting only the values seen with the
+// same config
+func (t *cardinalityTracker) guard(configID string, metrics []plugin.Metric, g *cardinalityGuard, now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	tracked, ok := t.configs[configID]
+	if !ok {
+		tracked = make(map[string]*trackedValues)
+		t.configs[configID] = tracked
+	}
+
+	for idx := range metrics {
+		var tags map[string]string
+		for tag, limit := range g.Limits {
+			value, ok := metrics[idx].Tags[tag]
+			if !ok || value == g.Placeholder || admit(tracked, tag, value, limit, g, now) {
+				continue
+			}
+			if tags == nil {
+				// The tags may be shared with other
+				// metrics, so edit a copy
+				tags = make(map[string]string, len(metrics[idx].Tags))
+				for k, v := range metrics[idx].Tags {
+					tags[k] = v
+				}
+				metrics[idx].Tags = tags
+			}
+			tags[tag] = g.Placeholder
+		}
+	}
+}
+
+// admit records a value of a tag, returning false if it's a new
+// value beyond the tag's limit
+func admit(tracked map[string]*trackedValues, tag string, value string, limit int, g *cardinalityGuard, now time.Time) bool {
+	values, ok := tracked[tag]
+	if !ok {
+		values = &trackedValues{lastSeen: make(map[string]time.Time), oldest: now}
+		tracked[tag] = values
+	}
+
+	if _, ok := values.lastSeen[value]; ok || len(values.lastSeen) < limit {
+		values.lastSeen[value] = now
+		return true
+	}
+
+	if !now.Before(values.oldest.Add(g.Window)) {
+		values.expire(now.Add(-g.Window))
+		if len(values.lastSeen) < limit {
+			values.lastSeen[value] = now
+			return true
+		}
+	}
+
+	values.overflows++
+	if !values.overflowing {
+		values.overflowing = true
+		warnFields := map[string]interface{}{
+			"tag":       tag,
+			"value":     value,
+			"limit":     limit,
+			"window":    g.Window.String(),
+			"overflows": values.overflows,
+		}
+		log.WithFields(warnFields).Warn("Tag has too many values, replacing new ones with " + g.Placeholder)
+	}
+	return false
+}
+
+// expire forgets the values last seen before cutoff
+func (v *trackedValues) expire(cutoff time.Time) {
+	oldest := time.Time{}
+	for value, lastSeen := range v.lastSeen {
+		if lastSeen.Before(cutoff) {
+			delete(v.lastSeen, value)
+			v.overflowing = false
+			continue
+		}
+		if oldest.IsZero() || lastSeen.Before(oldest) {
+			oldest = lastSeen
+		}
+	}
+	v.oldest = oldest
+}
+
+// overflows returns how many values of each tag have been replaced
+// with the config
+func (t *cardinalityTracker) overflows(configID string) map[string]uint64 {
+	t.Lock()
+	defer t.Unlock()
+
+	counts := make(map[string]uint64, len(t.configs[configID]))
+	for tag, values := range t.configs[configID] {
+		counts[tag] = values.overflows
+	}
+	return counts
+}
@@ -0,0 +1,145 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func cardinalityMetrics(tag string, values ...string) []plugin.Metric {
+	shared := map[string]string{"host": "web1"}
+	var mts []plugin.Metric
+	for _, value := range values {
+		tags := shared
+		if value != "" {
+			tags = map[string]string{"host": "web1", tag: value}
+		}
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      tags,
+			Data:      "line",
+		})
+	}
+	return mts
+}
+
+func tagValues(mts []plugin.Metric, tag string) []string {
+	var values []string
+	for _, m := range mts {
+		values = append(values, m.Tags[tag])
+	}
+	return values
+}
+
+func TestCardinalityGuard(t *testing.T) {
+	Convey("Test limiting tag values", t, func() {
+		guard, err := compileCardinalityGuard("{limits: {request_id: 2}, window: 1m}")
+		So(err, ShouldBeNil)
+		So(guard.Window, ShouldEqual, time.Minute)
+		So(guard.Placeholder, ShouldEqual, defaultCardinalityPlaceholder)
+
+		tracker := newCardinalityTracker()
+		start := time.Now()
+
+		mts := cardinalityMetrics("request_id", "a", "b", "c", "a", "")
+		tracker.guard("task", mts, guard, start)
+		So(tagValues(mts, "request_id"), ShouldResemble, []string{"a", "b", defaultCardinalityPlaceholder, "a", ""})
+		So(mts[4].Tags, ShouldNotContainKey, "request_id")
+		So(tracker.overflows("task")["request_id"], ShouldEqual, 1)
+
+		Convey("across Process calls", func() {
+			mts := cardinalityMetrics("request_id", "d", "b")
+			tracker.guard("task", mts, guard, start.Add(30*time.Second))
+			So(tagValues(mts, "request_id"), ShouldResemble, []string{defaultCardinalityPlaceholder, "b"})
+			So(tracker.overflows("task")["request_id"], ShouldEqual, 2)
+
+			Convey("until values expire", func() {
+				// a was last seen at the start, b 30s later
+				mts := cardinalityMetrics("request_id", "e", "f")
+				tracker.guard("task", mts, guard, start.Add(61*time.Second))
+				So(tagValues(mts, "request_id"), ShouldResemble, []string{"e", defaultCardinalityPlaceholder})
+			})
+		})
+
+		Convey("Bad configs are rejected", func() {
+			_, err := compileCardinalityGuard("{window: 1m}")
+			So(err, ShouldNotBeNil)
+			_, err = compileCardinalityGuard("{limits: {x: 0}}")
+			So(err, ShouldNotBeNil)
+			_, err = compileCardinalityGuard("{limits: {x: 1}, window: soon}")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test the cardinality guard in Process", t, func() {
+		config := plugin.Config{
+			configCardinality: `{limits: {id: 3}, placeholder: other}`,
+			"^":               `{parse: ['id=(?P<id>\S+)']}`,
+		}
+		var mts []plugin.Metric
+		for i := 0; i < 5; i++ {
+			mts = append(mts, plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      fmt.Sprintf("id=%d", i),
+			})
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+		So(tagValues(metrics, "id"), ShouldResemble, []string{"0", "1", "2", "other", "other"})
+
+		metrics, err = newPlugin.Process(mts[1:2], config)
+		So(err, ShouldBeNil)
+		So(tagValues(metrics, "id"), ShouldResemble, []string{"1"})
+
+		Convey("counting each task's values apart", func() {
+			other := plugin.Config{
+				configCardinality: `{limits: {id: 3}, placeholder: elsewhere}`,
+				"^":               `{parse: ['id=(?P<id>\S+)']}`,
+			}
+			metrics, err := newPlugin.Process(mts[2:], other)
+			So(err, ShouldBeNil)
+			So(tagValues(metrics, "id"), ShouldResemble, []string{"2", "3", "4"})
+		})
+	})
+
+	Convey("Test config IDs", t, func() {
+		config := plugin.Config{
+			configGateTag: "gate",
+			configGates:   []interface{}{map[string]interface{}{"name": "a", "match": "x", "parse": []string{"y"}}},
+		}
+		same := plugin.Config{
+			configGates:   []interface{}{map[string]interface{}{"parse": []string{"y"}, "match": "x", "name": "a"}},
+			configGateTag: "gate",
+		}
+		So(configID(config), ShouldEqual, configID(same))
+		same[configGateTag] = "other"
+		So(configID(config), ShouldNotEqual, configID(same))
+	})
+}
@@ -0,0 +1,100 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// How metrics whose Data isn't a string are handled
+const (
+	// Selected metrics are warned about and dropped
+	coerceDrop = "drop"
+	// Metrics are passed down the chain unmodified
+	coercePassthrough = "passthrough"
+	// []byte, numbers and bools are converted to strings,
+	// anything else is passed through
+	coerceConvert = "convert"
+	// Like convert, but anything else is JSON-marshalled
+	coerceJSON = "json"
+)
+
+func validateCoercion(mode string) error {
+	switch mode {
+	case coerceDrop, coercePassthrough, coerceConvert, coerceJSON:
+		return nil
+	}
+	return fmt.Errorf("%v must be one of %v, %v, %v or %v, not %q", configCoerceData, coerceDrop, coercePassthrough, coerceConvert, coerceJSON, mode)
+}
+
+// coerceData returns the metric data as a string according to the
+// coercion mode, and whether it could be made into one
+func coerceData(data interface{}, mode string) (string, bool) {
+	if str, ok := data.(string); ok {
+		return str, true
+	}
+	if mode != coerceConvert && mode != coerceJSON {
+		return "", false
+	}
+
+	switch v := data.(type) {
+	case []byte:
+		if !utf8.Valid(v) {
+			return "", false
+		}
+		return string(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.FormatInt(int64(v), 10), true
+	case int8:
+		return strconv.FormatInt(int64(v), 10), true
+	case int16:
+		return strconv.FormatInt(int64(v), 10), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	if mode == coerceJSON && data != nil {
+		marshalled, err := json.Marshal(data)
+		if err == nil {
+			return string(marshalled), true
+		}
+	}
+	return "", false
+}
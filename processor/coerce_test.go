@@ -0,0 +1,143 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCoerceData(t *testing.T) {
+	Convey("Test coercing metric data to strings", t, func() {
+		Convey("Strings are always strings", func() {
+			for _, mode := range []string{coerceDrop, coercePassthrough, coerceConvert, coerceJSON} {
+				str, ok := coerceData("hello", mode)
+				So(ok, ShouldBeTrue)
+				So(str, ShouldEqual, "hello")
+			}
+		})
+
+		Convey("Nothing else is coerced when dropping or passing through", func() {
+			_, ok := coerceData(123, coerceDrop)
+			So(ok, ShouldBeFalse)
+			_, ok = coerceData([]byte("hello"), coercePassthrough)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Converting handles bytes, numbers and bools", func() {
+			str, ok := coerceData([]byte("hello"), coerceConvert)
+			So(ok, ShouldBeTrue)
+			So(str, ShouldEqual, "hello")
+			_, ok = coerceData([]byte{0xff, 0xfe}, coerceConvert)
+			So(ok, ShouldBeFalse)
+			str, _ = coerceData(int64(-12), coerceConvert)
+			So(str, ShouldEqual, "-12")
+			str, _ = coerceData(uint32(12), coerceConvert)
+			So(str, ShouldEqual, "12")
+			str, _ = coerceData(1.5, coerceConvert)
+			So(str, ShouldEqual, "1.5")
+			str, _ = coerceData(float32(0.1), coerceConvert)
+			So(str, ShouldEqual, "0.1")
+			str, _ = coerceData(true, coerceConvert)
+			So(str, ShouldEqual, "true")
+			_, ok = coerceData(map[string]int{"a": 1}, coerceConvert)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("JSON mode marshals anything else", func() {
+			str, ok := coerceData(map[string]int{"a": 1}, coerceJSON)
+			So(ok, ShouldBeTrue)
+			So(str, ShouldEqual, `{"a":1}`)
+			_, ok = coerceData(nil, coerceJSON)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Unknown modes are rejected", func() {
+			So(validateCoercion("bogus"), ShouldNotBeNil)
+			So(validateCoercion(coerceJSON), ShouldBeNil)
+		})
+	})
+}
+
+func TestProcessNonStringData(t *testing.T) {
+	Convey("Test processing metrics with non-string data", t, func() {
+		config := plugin.Config{
+			"^status":  "parse:\n  - '^status (?P<status>[a-z]+)'\n",
+			"^[0-9]+$": "parse:\n  - '^(?P<number>[0-9]+)$'\n",
+		}
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      []byte("status ok"),
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      404,
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      map[string]string{"status": "ok"},
+			},
+		}
+
+		Convey("By default they are dropped", func() {
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 0)
+		})
+
+		Convey("Passthrough passes them on unmodified", func() {
+			config[configCoerceData] = coercePassthrough
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			So(metrics[1].Data, ShouldEqual, 404)
+			So(metrics[1].Tags, ShouldNotContainKey, "number")
+		})
+
+		Convey("Convert processes what it can and passes on the rest", func() {
+			config[configCoerceData] = coerceConvert
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			So(metrics[0].Data, ShouldEqual, "status ok")
+			So(metrics[0].Tags["status"], ShouldEqual, "ok")
+			So(metrics[1].Data, ShouldEqual, "404")
+			So(metrics[1].Tags["number"], ShouldEqual, "404")
+			So(metrics[2].Data, ShouldResemble, map[string]string{"status": "ok"})
+		})
+
+		Convey("A bad mode is a config error", func() {
+			config[configCoerceData] = "bogus"
+			_, err := New().Process(mts, config)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,714 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Top level keys that aren't gate regexes
+	configGates       = "gates"
+	configGateTag     = "gate_tag"
+	configCoerceData  = "coerce_data"
+	configRedact      = "redact"
+	configLookups     = "lookups"
+	configCardinality = "cardinality"
+	configSelfMetrics = "self_metrics"
+	configDebug       = "debug"
+
+	// Defaults for every gate, which gates can override
+	configOnError  = "on_error"
+	configErrorTag = "error_tag"
+
+	configDeadLetterSuffix = "dead_letter_suffix"
+
+	configIPNetworks    = "ip_networks"
+	configGeoIPDatabase = "geoip_database"
+
+	configUserAgentRules = "useragent_rules"
+
+	// Gate keys only meaningful in the structured form
+	configGateName  = "name"
+	configGateMatch = "match"
+)
+
+// reservedKeys are the top level config keys that configure the
+// plugin as a whole rather than naming a gate regex
+var reservedKeys = map[string]bool{
+	configGates:       true,
+	configGateTag:     true,
+	configCoerceData:  true,
+	configRedact:      true,
+	configLookups:     true,
+	configCardinality: true,
+	configSelfMetrics: true,
+	configDebug:       true,
+
+	configOnError:  true,
+	configErrorTag: true,
+
+	configDeadLetterSuffix: true,
+
+	configIPNetworks:    true,
+	configGeoIPDatabase: true,
+
+	configUserAgentRules: true,
+}
+
+// pluginConfig is the compiled form of a task's config
+type pluginConfig struct {
+	// ID identifies the config the state kept between
+	// Process calls belongs to
+	ID    string
+	Gates []internalConfig
+	// GateTag, when set, names a tag that records which
+	// gate processed a metric
+	GateTag string
+	// CoerceData is how metrics whose Data isn't
+	// a string are handled
+	CoerceData string
+	// Redactor, when set, redacts every metric
+	// passed down the chain
+	Redactor *redactor
+	// Lookups are the lookup tables by name
+	Lookups map[string]*lookupTable
+	// IPEnricher classifies and geolocates IP addresses
+	IPEnricher *ipEnricher
+	// UserAgentParser parses user agents, with the built-in
+	// rules unless a rules file is given
+	UserAgentParser *userAgentParser
+	// Cardinality, when set, limits the number of
+	// values of some tags
+	Cardinality *cardinalityGuard
+	// OnError is what to do about a metric a gate fails to
+	// process, and ErrorTag is the tag recording why
+	OnError  string
+	ErrorTag string
+	// DeadLetterSuffix is added to the namespace of
+	// metrics sent to the dead letter route
+	DeadLetterSuffix []string
+	// SelfMetrics, when set, adds metrics about
+	// what the plugin did to its output
+	SelfMetrics *selfMetrics
+	// Debug, when set, logs a trace of how each
+	// metric, or each one it matches, is processed
+	Debug *debugTrace
+}
+
+// parseConfig compiles the config into gates, loading the local
+// files it refers to through files. Gates from the structured
+// "gates" list come first, in order, followed by the gates keyed
+// by their regex, in lexical order.
+func parseConfig(cfg plugin.Config, files *fileCache) (*pluginConfig, error) {
+	var err error
+	parsed := &pluginConfig{
+		ID:               configID(cfg),
+		CoerceData:       coerceDrop,
+		OnError:          errorDropMetric,
+		ErrorTag:         defaultErrorTag,
+		DeadLetterSuffix: defaultDeadLetterSuffix,
+	}
+
+	// Keys now reserved may have been gate regexes in older
+	// configs; rather than quietly losing the gate, say so
+	for key := range reservedKeys {
+		if iValue, ok := cfg[key]; ok && isGateConfig(iValue) {
+			return nil, fmt.Errorf("%q is a plugin setting, so it can't be a gate regex; list the gate under %v instead", key, configGates)
+		}
+	}
+
+	if iGateTag, ok := cfg[configGateTag]; ok {
+		parsed.GateTag, ok = iGateTag.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a string, not a %T with value %v", configGateTag, iGateTag, iGateTag)
+		}
+	}
+
+	if iCoerceData, ok := cfg[configCoerceData]; ok {
+		parsed.CoerceData, ok = iCoerceData.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a string, not a %T with value %v", configCoerceData, iCoerceData, iCoerceData)
+		}
+		err = validateCoercion(parsed.CoerceData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if iRedact, ok := cfg[configRedact]; ok {
+		parsed.Redactor, err = compileRedactor(iRedact)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %v: %v", configRedact, err)
+		}
+	}
+
+	if iLookups, ok := cfg[configLookups]; ok {
+		parsed.Lookups, err = compileLookupTables(iLookups, files)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load %v: %v", configLookups, err)
+		}
+	}
+
+	if iCardinality, ok := cfg[configCardinality]; ok {
+		parsed.Cardinality, err = compileCardinalityGuard(iCardinality)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %v: %v", configCardinality, err)
+		}
+	}
+
+	err = compileErrorPolicy(cfg[configOnError], cfg[configErrorTag], &parsed.OnError, &parsed.ErrorTag)
+	if err != nil {
+		return nil, err
+	}
+
+	if iSuffix, ok := cfg[configDeadLetterSuffix]; ok {
+		parsed.DeadLetterSuffix, err = compileNamespace(iSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configDeadLetterSuffix, err)
+		}
+	}
+
+	if iSelfMetrics, ok := cfg[configSelfMetrics]; ok {
+		parsed.SelfMetrics, err = compileSelfMetrics(iSelfMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %v: %v", configSelfMetrics, err)
+		}
+	}
+
+	if iDebug, ok := cfg[configDebug]; ok {
+		parsed.Debug, err = compileDebugTrace(iDebug)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse %v: %v", configDebug, err)
+		}
+	}
+
+	parsed.IPEnricher, err = compileIPEnricher(cfg[configIPNetworks], cfg[configGeoIPDatabase], files)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed.UserAgentParser, err = compileUserAgentParser(cfg[configUserAgentRules], files)
+	if err != nil {
+		return nil, err
+	}
+
+	if iGates, ok := cfg[configGates]; ok {
+		parsed.Gates, err = parseStructuredGates(iGates, parsed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rawRegexes []string
+	for rawRegex := range cfg {
+		if !reservedKeys[rawRegex] {
+			rawRegexes = append(rawRegexes, rawRegex)
+		}
+	}
+	sort.Strings(rawRegexes)
+
+	for _, rawRegex := range rawRegexes {
+		rawGateCfg, err := decodeGateConfig(cfg[rawRegex])
+		if err != nil {
+			return nil, fmt.Errorf("Gate %q: %v", rawRegex, err)
+		}
+		if _, ok := rawGateCfg[configGateMatch]; ok {
+			return nil, fmt.Errorf("Gate %q: %v is only valid in the %v list", rawRegex, configGateMatch, configGates)
+		}
+		rawGateCfg[configGateMatch] = rawRegex
+		if _, ok := rawGateCfg[configGateName]; !ok {
+			rawGateCfg[configGateName] = rawRegex
+		}
+		gate, err := compileGate(rawGateCfg, parsed)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Gates = append(parsed.Gates, gate)
+	}
+
+	names := make(map[string]bool, len(parsed.Gates))
+	for _, gate := range parsed.Gates {
+		if names[gate.Name] {
+			return nil, fmt.Errorf("Gate %q: gate names must be unique", gate.Name)
+		}
+		names[gate.Name] = true
+	}
+
+	if len(parsed.Gates) < 1 {
+		return nil, fmt.Errorf("At least one match->parse block must be specified")
+	}
+	return parsed, nil
+}
+
+// templateFuncs are the extra functions available to tag templates
+func (c *pluginConfig) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"lookup": lookupFunc(c.Lookups),
+	}
+}
+
+// configID returns a hash identifying the config. Snap shares one
+// plugin between tasks, so the state kept between Process calls is
+// kept by config; tasks with the same config share it.
+func configID(cfg plugin.Config) string {
+	hash := fnv.New64a()
+	writeConfigValue(hash, cfg)
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// writeConfigValue writes a config value to w, with the keys
+// of maps sorted so equal values are written the same
+func writeConfigValue(w io.Writer, from interface{}) {
+	if from == nil {
+		io.WriteString(w, "nil")
+		return
+	}
+	value := reflect.ValueOf(from)
+	switch value.Kind() {
+	case reflect.Map:
+		keys := value.MapKeys()
+		names := make([]string, len(keys))
+		byName := make(map[string]reflect.Value, len(keys))
+		for idx, key := range keys {
+			names[idx] = fmt.Sprintf("%#v", key.Interface())
+			byName[names[idx]] = key
+		}
+		sort.Strings(names)
+		io.WriteString(w, "{")
+		for _, name := range names {
+			io.WriteString(w, name+":")
+			writeConfigValue(w, value.MapIndex(byName[name]).Interface())
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		io.WriteString(w, "[")
+		for idx := 0; idx < value.Len(); idx++ {
+			writeConfigValue(w, value.Index(idx).Interface())
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "]")
+	default:
+		fmt.Fprintf(w, "%#v", from)
+	}
+}
+
+// isGateConfig reports whether a config value is a gate's dict
+// of directives, by its parse regexes
+func isGateConfig(from interface{}) bool {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return false
+	}
+	rawGateCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = rawGateCfg[configParseRegexp]
+	return ok
+}
+
+// decodeGateConfig turns the value of a regex-keyed gate into
+// its dict of directives
+func decodeGateConfig(from interface{}) (map[interface{}]interface{}, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawGateCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Gate config must be a dict, not a %T", decoded)
+	}
+	return rawGateCfg, nil
+}
+
+// decodeConfigValue accepts a config value as a YAML string, a JSON
+// string or a native map or list, and returns it in the same shape
+// yaml.Unmarshal would: dicts as map[interface{}]interface{} and
+// lists as []interface{}
+func decodeConfigValue(from interface{}) (interface{}, error) {
+	switch v := from.(type) {
+	case string:
+		var decoded interface{}
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			err := json.Unmarshal([]byte(trimmed), &decoded)
+			if err == nil {
+				return normalizeConfigValue(decoded), nil
+			}
+			// Flow-style YAML looks like JSON, so fall through
+		}
+		err := yaml.Unmarshal([]byte(v), &decoded)
+		if err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	case nil:
+		return nil, fmt.Errorf("Config value is empty")
+	}
+
+	kind := reflect.TypeOf(from).Kind()
+	if kind != reflect.Map && kind != reflect.Slice && kind != reflect.Array {
+		return nil, fmt.Errorf("Config value must be a YAML or JSON string, a dict or a list, not a %T", from)
+	}
+	return normalizeConfigValue(from), nil
+}
+
+// normalizeConfigValue recursively converts native maps and slices of
+// any type into their YAML-shaped equivalents
+func normalizeConfigValue(from interface{}) interface{} {
+	if from == nil {
+		return nil
+	}
+	value := reflect.ValueOf(from)
+	switch value.Kind() {
+	case reflect.Map:
+		normalized := make(map[interface{}]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			normalized[key.Interface()] = normalizeConfigValue(value.MapIndex(key).Interface())
+		}
+		return normalized
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte is a string, not a list of numbers
+			return string(value.Bytes())
+		}
+		normalized := make([]interface{}, value.Len())
+		for idx := range normalized {
+			normalized[idx] = normalizeConfigValue(value.Index(idx).Interface())
+		}
+		return normalized
+	}
+	return from
+}
+
+// compileStringList reads a list of strings
+func compileStringList(from interface{}) ([]string, error) {
+	rawList, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be a list, not a %T", from)
+	}
+	var list []string
+	for _, iItem := range rawList {
+		item, ok := iItem.(string)
+		if !ok {
+			return nil, fmt.Errorf("Entry not a string but %T with value %v", iItem, iItem)
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// configInt reads a whole number written as a YAML or JSON number,
+// or as a string
+func configInt(from interface{}) (int, error) {
+	switch v := from.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("%v isn't a whole number", from)
+}
+
+// configFloat reads a number written as a YAML or JSON number, or
+// as a string
+func configFloat(from interface{}) (float64, error) {
+	switch v := from.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%v isn't a number", from)
+}
+
+// configDuration reads a duration written like "30s" or "1h", or
+// as a number of seconds
+func configDuration(from interface{}) (time.Duration, error) {
+	if str, ok := from.(string); ok {
+		duration, err := time.ParseDuration(str)
+		if err == nil {
+			return duration, nil
+		}
+	}
+	seconds, err := configInt(from)
+	if err != nil {
+		return 0, fmt.Errorf("%v isn't a duration", from)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func parseStructuredGates(from interface{}, parsed *pluginConfig) ([]internalConfig, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse %v: %v", configGates, err)
+	}
+	rawGates, ok := decoded.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configGates, decoded)
+	}
+
+	var gates []internalConfig
+	for idx, iRawGate := range rawGates {
+		rawGateCfg, ok := iRawGate.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Gate #%d in %v must be a dict, not a %T", idx, configGates, iRawGate)
+		}
+		if _, ok := rawGateCfg[configGateName]; !ok {
+			return nil, fmt.Errorf("Gate #%d in %v has no %v", idx, configGates, configGateName)
+		}
+		gate, err := compileGate(rawGateCfg, parsed)
+		if err != nil {
+			return nil, err
+		}
+		gates = append(gates, gate)
+	}
+	return gates, nil
+}
+
+// compileGate compiles the directives of one gate; name and
+// match are always present by the time we get here, as are
+// the parts of parsed that gates refer to
+func compileGate(rawGateCfg map[interface{}]interface{}, parsed *pluginConfig) (internalConfig, error) {
+	var err error
+	var gate internalConfig
+
+	name, ok := rawGateCfg[configGateName].(string)
+	if !ok || name == "" {
+		return gate, fmt.Errorf("Gate name must be a non-empty string, not %v", rawGateCfg[configGateName])
+	}
+	gate.Name = name
+
+	rawMatch, ok := rawGateCfg[configGateMatch].(string)
+	if !ok {
+		return gate, fmt.Errorf("Gate %q: %v must be a regex string", name, configGateMatch)
+	}
+	gate.Match, err = regexp.Compile(rawMatch)
+	if err != nil {
+		return gate, fmt.Errorf("Gate %q: couldn't compile %v regex: %v", name, configGateMatch, err)
+	}
+
+	splitRegexesRaw, ok := rawGateCfg[configSplitRegexp].([]interface{})
+	if ok {
+		gate.Split, err = compileRegexes(splitRegexesRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: couldn't compile split regexes: %v", name, err)
+		}
+	}
+
+	parseRegexesRaw, ok := rawGateCfg[configParseRegexp].([]interface{})
+	if !ok {
+		return gate, fmt.Errorf("Gate %q: must specify parse regexps at least", name)
+	}
+	gate.ParseMode = parseModeAllOverride
+	if iParseMode, ok := rawGateCfg[configParseMode]; ok {
+		gate.ParseMode, ok = iParseMode.(string)
+		if !ok {
+			return gate, fmt.Errorf("Gate %q: %v must be a string, not a %T", name, configParseMode, iParseMode)
+		}
+		err = validateParseMode(gate.ParseMode)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+	defaultRule := parseRule{
+		Required:  gate.ParseMode == parseModeAllRequired,
+		Overwrite: true,
+	}
+	err = compileParseRuleOptions(rawGateCfg, &defaultRule)
+	if err != nil {
+		return gate, fmt.Errorf("Gate %q: %v", name, err)
+	}
+	gate.Parse, err = compileParseRules(parseRegexesRaw, defaultRule)
+	if err != nil {
+		return gate, fmt.Errorf("Gate %q: failed to compile a regex: %v", name, err)
+	}
+
+	// Unless set, parse failures follow on_error
+	if iParseFailure, ok := rawGateCfg[configParseFailure]; ok {
+		gate.ParseFailure, ok = iParseFailure.(string)
+		if !ok {
+			return gate, fmt.Errorf("Gate %q: %v must be a string, not a %T", name, configParseFailure, iParseFailure)
+		}
+		err = validateParseFailure(gate.ParseFailure)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+	gate.OnError, gate.ErrorTag = parsed.OnError, parsed.ErrorTag
+	gate.DeadLetterSuffix = parsed.DeadLetterSuffix
+	err = compileErrorPolicy(rawGateCfg[configOnError], rawGateCfg[configErrorTag], &gate.OnError, &gate.ErrorTag)
+	if err != nil {
+		return gate, fmt.Errorf("Gate %q: %v", name, err)
+	}
+
+	gate.ParseFailureTag = defaultParseFailureTag
+	if iParseFailureTag, ok := rawGateCfg[configParseFailureTag]; ok {
+		gate.ParseFailureTag, ok = iParseFailureTag.(string)
+		if !ok || gate.ParseFailureTag == "" {
+			return gate, fmt.Errorf("Gate %q: %v must be a non-empty string", name, configParseFailureTag)
+		}
+	}
+
+	gate.ParseAllSeparator = defaultParseAllSeparator
+	if iParseAll, ok := rawGateCfg[configParseAll]; ok {
+		gate.ParseAll, ok = iParseAll.(string)
+		if !ok {
+			return gate, fmt.Errorf("Gate %q: %v must be a string, not a %T", name, configParseAll, iParseAll)
+		}
+		err = validateParseAll(gate.ParseAll)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+	if iSeparator, ok := rawGateCfg[configParseAllSep]; ok {
+		gate.ParseAllSeparator, ok = iSeparator.(string)
+		if !ok {
+			return gate, fmt.Errorf("Gate %q: %v must be a string, not a %T", name, configParseAllSep, iSeparator)
+		}
+	}
+
+	tagTemplatesRaw, ok := rawGateCfg[configAddTags].(map[interface{}]interface{})
+	if ok {
+		gate.Template, err = compileTemplates(tagTemplatesRaw, parsed.templateFuncs())
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if namespacesRaw, ok := rawGateCfg[configNamespace]; ok {
+		gate.Namespaces, err = compileNamespaceSelectors(namespacesRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if tagMatchesRaw, ok := rawGateCfg[configMatchTags]; ok {
+		gate.Tags, err = compileTagSelectors(tagMatchesRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if lookupsRaw, ok := rawGateCfg[configLookup]; ok {
+		gate.Lookups, err = compileGateLookups(lookupsRaw, parsed.Lookups)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if ipEnrichRaw, ok := rawGateCfg[configIPEnrich]; ok {
+		gate.IPEnrich, err = compileGateIPEnrich(ipEnrichRaw, parsed.IPEnricher)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if userAgentRaw, ok := rawGateCfg[configUserAgent]; ok {
+		gate.UserAgent, err = compileGateUserAgent(userAgentRaw, parsed.UserAgentParser)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if urlRaw, ok := rawGateCfg[configURL]; ok {
+		gate.URLs, err = compileGateURLs(urlRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if countersRaw, ok := rawGateCfg[configEmitCounters]; ok {
+		gate.Counters, err = compileGateCounters(countersRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if aggregateRaw, ok := rawGateCfg[configAggregate]; ok {
+		gate.Aggregate, err = compileGateAggregate(aggregateRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if dedupRaw, ok := rawGateCfg[configDedup]; ok {
+		gate.Dedup, err = compileGateDedup(dedupRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if samplingRaw, ok := rawGateCfg[configSampleRate]; ok {
+		gate.Sampling, err = compileGateSampling(samplingRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	if rateLimitRaw, ok := rawGateCfg[configRateLimit]; ok {
+		gate.RateLimit, err = compileGateRateLimit(rateLimitRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	gate.TagEdits, err = compileTagEdits(rawGateCfg)
+	if err != nil {
+		return gate, fmt.Errorf("Gate %q: %v", name, err)
+	}
+
+	if testsRaw, ok := rawGateCfg[configTests]; ok {
+		gate.Tests, err = compileRuleTests(testsRaw)
+		if err != nil {
+			return gate, fmt.Errorf("Gate %q: %v", name, err)
+		}
+	}
+
+	return gate, nil
+}
@@ -0,0 +1,201 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const structuredGates = `
+- name: features
+  match: "^feature "
+  split:
+    - '\|'
+  parse:
+    - '^feature (?P<feature_name>[A-Za-z0-9]*)$'
+  tags:
+    feature_index: "{{ .Tags.feature_name }}"
+- name: errors
+  match: "^error "
+  parse:
+    - '^error (?P<code>[0-9]+)'
+`
+
+func TestStructuredConfig(t *testing.T) {
+	Convey("Test parsing the structured gates list", t, func() {
+		config := plugin.Config{
+			configGates:   structuredGates,
+			configGateTag: "gate",
+			"^legacy ":    "parse:\n  - '^legacy (?P<word>.*)'\n",
+		}
+
+		Convey("Gates keep their names and order", func() {
+			parsed, err := parseConfig(config, nil)
+			So(err, ShouldBeNil)
+			So(parsed.GateTag, ShouldEqual, "gate")
+			So(len(parsed.Gates), ShouldEqual, 3)
+			So(parsed.Gates[0].Name, ShouldEqual, "features")
+			So(parsed.Gates[1].Name, ShouldEqual, "errors")
+			So(parsed.Gates[2].Name, ShouldEqual, "^legacy ")
+			So(parsed.Gates[2].Match.String(), ShouldEqual, "^legacy ")
+		})
+
+		Convey("The gate tag records the gate that processed a metric", func() {
+			mts := []plugin.Metric{
+				plugin.Metric{
+					Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+					Timestamp: time.Now(),
+					Tags:      map[string]string{},
+					Data:      "feature 1|feature 2",
+				},
+				plugin.Metric{
+					Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+					Timestamp: time.Now(),
+					Tags:      map[string]string{},
+					Data:      "error 500",
+				},
+				plugin.Metric{
+					Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+					Timestamp: time.Now(),
+					Tags:      map[string]string{},
+					Data:      "legacy hello",
+				},
+			}
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 4)
+			So(metrics[0].Tags["gate"], ShouldEqual, "features")
+			So(metrics[1].Tags["feature_index"], ShouldEqual, "2")
+			So(metrics[2].Tags["gate"], ShouldEqual, "errors")
+			So(metrics[2].Tags["code"], ShouldEqual, "500")
+			So(metrics[3].Tags["gate"], ShouldEqual, "^legacy ")
+			So(metrics[3].Tags["word"], ShouldEqual, "hello")
+		})
+
+		Convey("A regex-keyed gate can be given a name", func() {
+			config["^legacy "] = "name: legacy\nparse:\n  - '.*'\n"
+			parsed, err := parseConfig(config, nil)
+			So(err, ShouldBeNil)
+			So(parsed.Gates[2].Name, ShouldEqual, "legacy")
+		})
+
+		Convey("Errors name the gate", func() {
+			config[configGates] = "- name: broken\n  match: '^('\n  parse: ['.*']\n"
+			_, err := parseConfig(config, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `"broken"`)
+		})
+
+		Convey("Gate names must be unique", func() {
+			config["^legacy "] = "name: errors\nparse:\n  - '.*'\n"
+			_, err := parseConfig(config, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Structured gates must be named", func() {
+			config[configGates] = "- match: '.*'\n  parse: ['.*']\n"
+			_, err := parseConfig(config, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Reserved keys can't be gate regexes", func() {
+			for _, key := range []string{configGates, configGateTag, configDebug, configRedact} {
+				_, err := parseConfig(plugin.Config{key: "parse:\n  - '(?P<x>.*)'\n"}, nil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, fmt.Sprintf("%q is a plugin setting", key))
+			}
+		})
+	})
+}
+
+func TestConfigValueTypes(t *testing.T) {
+	Convey("Test gate configs given as different value types", t, func() {
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "feature 1",
+			},
+		}
+
+		Convey("A native map works like the YAML string", func() {
+			config := plugin.Config{
+				"^feature": map[string]interface{}{
+					configParseRegexp: []string{`^feature (?P<feature_name>[0-9]+)`},
+					configAddTags:     map[string]string{"index": "{{ .Tags.feature_name }}"},
+				},
+			}
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Tags["index"], ShouldEqual, "1")
+		})
+
+		Convey("A JSON string works like the YAML string", func() {
+			config := plugin.Config{
+				"^feature": `{"parse": ["^feature (?P<feature_name>[0-9]+)"]}`,
+			}
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldBeNil)
+			So(metrics[0].Tags["feature_name"], ShouldEqual, "1")
+		})
+
+		Convey("A native gates list and a JSON gates list are accepted", func() {
+			nativeGates := []interface{}{
+				map[string]interface{}{
+					configGateName:    "features",
+					configGateMatch:   "^feature",
+					configParseRegexp: []interface{}{`^feature (?P<feature_name>[0-9]+)`},
+				},
+			}
+			parsed, err := parseConfig(plugin.Config{configGates: nativeGates}, nil)
+			So(err, ShouldBeNil)
+			So(parsed.Gates[0].Name, ShouldEqual, "features")
+
+			jsonGates := `[{"name": "features", "match": "^feature", "parse": [".*"]}]`
+			parsed, err = parseConfig(plugin.Config{configGates: jsonGates}, nil)
+			So(err, ShouldBeNil)
+			So(parsed.Gates[0].Name, ShouldEqual, "features")
+		})
+
+		Convey("Unsupported value types are an error, not stale config", func() {
+			config := plugin.Config{
+				"^a": "parse:\n  - '.*'\n",
+				"^b": int64(12),
+			}
+			metrics, err := New().Process(mts, config)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `"^b"`)
+			So(metrics, ShouldBeNil)
+
+			_, err = parseConfig(plugin.Config{"^a": true}, nil)
+			So(err, ShouldNotBeNil)
+			_, err = parseConfig(plugin.Config{"^a": "just a string"}, nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
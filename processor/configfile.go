@@ -0,0 +1,96 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// Keys of a task manifest
+	manifestWorkflow   = "workflow"
+	manifestCollect    = "collect"
+	manifestProcess    = "process"
+	manifestPublish    = "publish"
+	manifestPluginName = "plugin_name"
+	manifestConfig     = "config"
+)
+
+// LoadConfig reads the plugin's config from a YAML or JSON document:
+// either a task manifest, in which case it's the config of the first
+// regexp-engine node of the workflow, or a rules file holding the
+// config itself
+func LoadConfig(data []byte) (plugin.Config, error) {
+	var doc map[interface{}]interface{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if iWorkflow, ok := doc[manifestWorkflow]; ok {
+		workflow, ok := iWorkflow.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Task manifest %v must be a dict, not a %T", manifestWorkflow, iWorkflow)
+		}
+		node, ok := workflow[manifestCollect].(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Task manifest has no %v node", manifestCollect)
+		}
+		doc = findPluginConfig(node)
+		if doc == nil {
+			return nil, fmt.Errorf("Task manifest has no %v node with a config", Name)
+		}
+	}
+
+	cfg := make(plugin.Config, len(doc))
+	for iKey, value := range doc {
+		key, ok := iKey.(string)
+		if !ok {
+			return nil, fmt.Errorf("Config key must be a string, not a %T with value %v", iKey, iKey)
+		}
+		cfg[key] = value
+	}
+	return cfg, nil
+}
+
+// findPluginConfig returns the config of the first regexp-engine
+// node under a workflow node, depth first, or nil if there's none
+func findPluginConfig(node map[interface{}]interface{}) map[interface{}]interface{} {
+	for _, key := range []string{manifestProcess, manifestPublish} {
+		children, _ := node[key].([]interface{})
+		for _, iChild := range children {
+			child, ok := iChild.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			if child[manifestPluginName] == Name {
+				if cfg, ok := child[manifestConfig].(map[interface{}]interface{}); ok {
+					return cfg
+				}
+			}
+			if cfg := findPluginConfig(child); cfg != nil {
+				return cfg
+			}
+		}
+	}
+	return nil
+}
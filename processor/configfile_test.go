@@ -0,0 +1,99 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoadConfig(t *testing.T) {
+	Convey("Test loading the config", t, func() {
+		Convey("from a task manifest", func() {
+			cfg, err := LoadConfig([]byte(`
+version: 1
+workflow:
+  collect:
+    metrics:
+      /intel/logs/*: {}
+    process:
+      - plugin_name: "tag"
+        config: {tags: "a:b"}
+        process:
+          - plugin_name: "regexp-engine"
+            config:
+              gate_tag: gate
+              "^feature ([A-Za-z0-9]+)":
+                split:
+                  - "\\|"
+                parse:
+                  - "^feature (?P<feature_name>[0-9]+)"
+            publish:
+              - plugin_name: "file"
+                config: {file: /tmp/logmetrics}
+`))
+			So(err, ShouldBeNil)
+			So(cfg, ShouldContainKey, "gate_tag")
+			So(cfg, ShouldContainKey, "^feature ([A-Za-z0-9]+)")
+			So(cfg, ShouldNotContainKey, "tags")
+
+			mts, err := New().Process([]plugin.Metric{{
+				Namespace: plugin.NewNamespace("intel", "logs", "message"),
+				Timestamp: time.Now(),
+				Data:      "feature 1|feature 2",
+			}}, cfg)
+			So(err, ShouldBeNil)
+			So(mts, ShouldHaveLength, 2)
+			So(mts[1].Tags, ShouldResemble, map[string]string{"feature_name": "2", "gate": "^feature ([A-Za-z0-9]+)"})
+		})
+
+		Convey("from a rules file", func() {
+			cfg, err := LoadConfig([]byte(`
+gates:
+  - name: features
+    match: "^feature"
+    parse: ['(?P<n>[0-9]+)']
+`))
+			So(err, ShouldBeNil)
+			parsed, err := parseConfig(cfg, newFileCache())
+			So(err, ShouldBeNil)
+			So(parsed.Gates, ShouldHaveLength, 1)
+			So(parsed.Gates[0].Name, ShouldEqual, "features")
+		})
+
+		Convey("rejecting manifests without the plugin", func() {
+			_, err := LoadConfig([]byte(`
+workflow:
+  collect:
+    publish:
+      - plugin_name: "file"
+`))
+			So(err, ShouldNotBeNil)
+			_, err = LoadConfig([]byte(`workflow: nope`))
+			So(err, ShouldNotBeNil)
+			_, err = LoadConfig([]byte(`[1, 2]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,163 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configCountersNamespace = "namespace"
+	configCountersTags      = "tags"
+	configCountersReplace   = "replace"
+
+	// counterGateTag names the gate a counter counts for
+	counterGateTag = "gate"
+	counterUnit    = "count"
+)
+
+var defaultCounterNamespace = []string{Name, "count"}
+
+// gateCounters counts the metrics a gate emits in each batch,
+// grouped by the values of Tags
+type gateCounters struct {
+	Namespace []string
+	Tags      []string
+	// Replace drops the counted metrics, keeping only the counts
+	Replace bool
+}
+
+// counterBatch holds the counts of one Process call
+type counterBatch struct {
+	counters map[string]*counter
+	// order keeps the counters in the order first seen
+	order []string
+}
+
+type counter struct {
+	namespace []string
+	tags      map[string]string
+	count     int64
+}
+
+func compileGateCounters(from interface{}) (*gateCounters, error) {
+	c := &gateCounters{Namespace: defaultCounterNamespace}
+
+	switch v := from.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return c, nil
+	case map[interface{}]interface{}:
+		if iNamespace, ok := v[configCountersNamespace]; ok {
+			namespace, err := compileNamespace(iNamespace)
+			if err != nil {
+				return nil, fmt.Errorf("%v %v: %v", configEmitCounters, configCountersNamespace, err)
+			}
+			c.Namespace = namespace
+		}
+		if iTags, ok := v[configCountersTags]; ok {
+			tags, err := compileStringList(iTags)
+			if err != nil {
+				return nil, fmt.Errorf("%v %v: %v", configEmitCounters, configCountersTags, err)
+			}
+			c.Tags = tags
+		}
+		if iReplace, ok := v[configCountersReplace]; ok {
+			c.Replace, ok = iReplace.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%v %v must be true or false, not %v", configEmitCounters, configCountersReplace, iReplace)
+			}
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("%v must be true or a dict, not a %T", configEmitCounters, from)
+}
+
+// compileNamespace reads a namespace written like "/a/b/c", or as
+// a list of its elements
+func compileNamespace(from interface{}) ([]string, error) {
+	var namespace []string
+	switch v := from.(type) {
+	case string:
+		namespace = strings.Split(strings.Trim(v, "/"), "/")
+	case []interface{}:
+		var err error
+		namespace, err = compileStringList(v)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Must be a string or a list, not a %T", from)
+	}
+	for _, element := range namespace {
+		if element == "" {
+			return nil, fmt.Errorf("%v has an empty element", from)
+		}
+	}
+	return namespace, nil
+}
+
+func newCounterBatch() *counterBatch {
+	return &counterBatch{counters: make(map[string]*counter)}
+}
+
+// add counts a metric emitted by a gate
+func (b *counterBatch) add(gate internalConfig, m plugin.Metric) {
+	tags := map[string]string{counterGateTag: gate.Name}
+	key := []string{strings.Join(gate.Counters.Namespace, "/"), gate.Name}
+	for _, tag := range gate.Counters.Tags {
+		value, ok := m.Tags[tag]
+		if ok {
+			tags[tag] = value
+		}
+		// Tell apart a missing tag from an empty one
+		key = append(key, fmt.Sprintf("%v:%q", ok, value))
+	}
+
+	id := strings.Join(key, "\x00")
+	c, ok := b.counters[id]
+	if !ok {
+		c = &counter{namespace: gate.Counters.Namespace, tags: tags}
+		b.counters[id] = c
+		b.order = append(b.order, id)
+	}
+	c.count++
+}
+
+// metrics returns a metric for each count
+func (b *counterBatch) metrics(now time.Time) []plugin.Metric {
+	var mts []plugin.Metric
+	for _, id := range b.order {
+		c := b.counters[id]
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace(c.namespace...),
+			Timestamp: now,
+			Tags:      c.tags,
+			Data:      c.count,
+			Unit:      counterUnit,
+		})
+	}
+	return mts
+}
@@ -0,0 +1,96 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEmitCounters(t *testing.T) {
+	lines := []string{
+		"api ERROR timeout",
+		"api ERROR refused",
+		"web ERROR timeout",
+		"web INFO ok",
+		"not a log line",
+	}
+	var mts []plugin.Metric
+	for _, line := range lines {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      map[string]string{},
+			Data:      line,
+		})
+	}
+
+	Convey("Test counting matches alongside the parsed metrics", t, func() {
+		config := plugin.Config{
+			"^[a-z]+ ERROR ": `
+name: errors
+parse:
+  - '^(?P<service>[a-z]+) ERROR (?P<reason>\S+)'
+emit_counters:
+  namespace: /intel/logs/errors
+  tags: [service]
+`,
+		}
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 7)
+
+		counts := metrics[5:]
+		So(counts[0].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "errors"})
+		So(counts[0].Tags, ShouldResemble, map[string]string{counterGateTag: "errors", "service": "api"})
+		So(counts[0].Data, ShouldEqual, 2)
+		So(counts[1].Tags["service"], ShouldEqual, "web")
+		So(counts[1].Data, ShouldEqual, 1)
+	})
+
+	Convey("Test counting matches instead of the parsed metrics", t, func() {
+		config := plugin.Config{
+			"ERROR": `{name: errors, parse: ['(?P<level>ERROR)'], emit_counters: {replace: true}}`,
+		}
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+		So(metrics[0].Data, ShouldEqual, "web INFO ok")
+		So(metrics[2].Namespace.Strings(), ShouldResemble, defaultCounterNamespace)
+		So(metrics[2].Tags, ShouldResemble, map[string]string{counterGateTag: "errors"})
+		So(metrics[2].Data, ShouldEqual, 3)
+	})
+
+	Convey("Test bad counter configs are rejected", t, func() {
+		_, err := compileGateCounters("yes")
+		So(err, ShouldNotBeNil)
+		_, err = compileGateCounters(map[interface{}]interface{}{configCountersNamespace: "a//b"})
+		So(err, ShouldNotBeNil)
+		_, err = compileGateCounters(map[interface{}]interface{}{configCountersTags: "service"})
+		So(err, ShouldNotBeNil)
+		counters, err := compileGateCounters(false)
+		So(err, ShouldBeNil)
+		So(counters, ShouldBeNil)
+	})
+}
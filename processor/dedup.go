@@ -0,0 +1,240 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configDedupBy         = "by"
+	configDedupWindow     = "window"
+	configDedupMaxEntries = "max_entries"
+	configDedupTag        = "tag"
+
+	defaultDedupWindow     = time.Minute
+	defaultDedupMaxEntries = 10000
+	defaultDedupTag        = "repeat_count"
+)
+
+// gateDedup holds back the metrics a gate emits for a window,
+// passing on one metric for all those with the same data, or the
+// same By tags, along with how many there were
+type gateDedup struct {
+	By         []string
+	Window     time.Duration
+	MaxEntries int
+	Tag        string
+}
+
+// deduplicator holds the metrics held back between Process calls,
+// by config ID and gate name
+type deduplicator struct {
+	sync.Mutex
+	configs map[string]map[string]*dedupStore
+}
+
+type dedupStore struct {
+	entries map[string]*list.Element
+	// order holds the entries oldest first
+	order *list.List
+}
+
+type dedupEntry struct {
+	id     string
+	metric plugin.Metric
+	count  int
+	end    time.Time
+	tag    string
+}
+
+func compileGateDedup(from interface{}) (*gateDedup, error) {
+	d := &gateDedup{
+		Window:     defaultDedupWindow,
+		MaxEntries: defaultDedupMaxEntries,
+		Tag:        defaultDedupTag,
+	}
+
+	switch v := from.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return d, nil
+	case map[interface{}]interface{}:
+		if iBy, ok := v[configDedupBy]; ok {
+			by, err := compileStringList(iBy)
+			if err != nil {
+				return nil, fmt.Errorf("%v %v: %v", configDedup, configDedupBy, err)
+			}
+			d.By = by
+		}
+		if iWindow, ok := v[configDedupWindow]; ok {
+			var err error
+			d.Window, err = configDuration(iWindow)
+			if err != nil || d.Window <= 0 {
+				return nil, fmt.Errorf("%v %v must be a positive duration, not %v", configDedup, configDedupWindow, iWindow)
+			}
+		}
+		if iMaxEntries, ok := v[configDedupMaxEntries]; ok {
+			var err error
+			d.MaxEntries, err = configInt(iMaxEntries)
+			if err != nil || d.MaxEntries < 1 {
+				return nil, fmt.Errorf("%v %v must be a positive number, not %v", configDedup, configDedupMaxEntries, iMaxEntries)
+			}
+		}
+		if iTag, ok := v[configDedupTag]; ok {
+			d.Tag, ok = iTag.(string)
+			if !ok || d.Tag == "" {
+				return nil, fmt.Errorf("%v %v must be a tag name, not %v", configDedup, configDedupTag, iTag)
+			}
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("%v must be true or a dict, not a %T", configDedup, from)
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{configs: make(map[string]map[string]*dedupStore)}
+}
+
+// key tells apart metrics that aren't repeats of each other
+func (d *gateDedup) key(m plugin.Metric) string {
+	key := []string{strings.Join(m.Namespace.Strings(), "/")}
+	if d.By == nil {
+		key = append(key, fmt.Sprint(m.Data))
+	}
+	for _, tag := range d.By {
+		value, ok := m.Tags[tag]
+		key = append(key, fmt.Sprintf("%v:%q", ok, value))
+	}
+	return strings.Join(key, "\x00")
+}
+
+// add holds back a metric emitted by a gate of the config with
+// the given ID, returning any metrics pushed out to keep within
+// the gate's max_entries
+func (d *deduplicator) add(configID string, gate internalConfig, m plugin.Metric, now time.Time) []plugin.Metric {
+	settings := gate.Dedup
+	id := settings.key(m)
+
+	d.Lock()
+	defer d.Unlock()
+
+	gates, ok := d.configs[configID]
+	if !ok {
+		gates = make(map[string]*dedupStore)
+		d.configs[configID] = gates
+	}
+	store, ok := gates[gate.Name]
+	if !ok {
+		store = &dedupStore{entries: make(map[string]*list.Element), order: list.New()}
+		gates[gate.Name] = store
+	}
+
+	if elem, ok := store.entries[id]; ok {
+		elem.Value.(*dedupEntry).count++
+		return nil
+	}
+
+	var evicted []plugin.Metric
+	for store.order.Len() >= settings.MaxEntries {
+		evicted = append(evicted, store.remove(store.order.Front()))
+	}
+	entry := &dedupEntry{
+		id:     id,
+		metric: m,
+		count:  1,
+		end:    now.Add(settings.Window),
+		tag:    settings.Tag,
+	}
+	store.entries[id] = store.order.PushBack(entry)
+	return evicted
+}
+
+// remove forgets an entry, returning its metric
+func (s *dedupStore) remove(elem *list.Element) plugin.Metric {
+	entry := s.order.Remove(elem).(*dedupEntry)
+	delete(s.entries, entry.id)
+
+	m := entry.metric
+	tags := make(map[string]string, len(m.Tags)+1)
+	for tag, value := range m.Tags {
+		tags[tag] = value
+	}
+	tags[entry.tag] = strconv.Itoa(entry.count)
+	m.Tags = tags
+	return m
+}
+
+// flush returns the config's metrics whose window has closed
+func (d *deduplicator) flush(configID string, now time.Time) []plugin.Metric {
+	return d.flushEntries(configID, func(entry *dedupEntry) bool {
+		return !now.Before(entry.end)
+	})
+}
+
+// drain returns all the config's metrics, whether or not
+// their window has closed
+func (d *deduplicator) drain(configID string) []plugin.Metric {
+	return d.flushEntries(configID, func(*dedupEntry) bool {
+		return true
+	})
+}
+
+// flushEntries returns the config's metrics that are due,
+// oldest first for each gate
+func (d *deduplicator) flushEntries(configID string, due func(*dedupEntry) bool) []plugin.Metric {
+	d.Lock()
+	defer d.Unlock()
+
+	gates := d.configs[configID]
+	var names []string
+	for name := range gates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mts []plugin.Metric
+	for _, name := range names {
+		store := gates[name]
+		for store.order.Len() > 0 {
+			front := store.order.Front()
+			if !due(front.Value.(*dedupEntry)) {
+				break
+			}
+			mts = append(mts, store.remove(front))
+		}
+		if store.order.Len() == 0 {
+			delete(gates, name)
+		}
+	}
+	if len(gates) == 0 {
+		delete(d.configs, configID)
+	}
+	return mts
+}
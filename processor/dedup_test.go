@@ -0,0 +1,138 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func dedupMetric(data string, tags map[string]string) plugin.Metric {
+	return plugin.Metric{
+		Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+		Timestamp: time.Now(),
+		Tags:      tags,
+		Data:      data,
+	}
+}
+
+func TestDedup(t *testing.T) {
+	Convey("Test holding back repeated metrics", t, func() {
+		settings, err := compileGateDedup(map[interface{}]interface{}{configDedupWindow: "1m"})
+		So(err, ShouldBeNil)
+		gate := internalConfig{Name: "flapping", Dedup: settings}
+		d := newDeduplicator()
+		start := time.Now()
+
+		So(d.add("task", gate, dedupMetric("link down", map[string]string{}), start), ShouldBeEmpty)
+		So(d.add("task", gate, dedupMetric("link up", map[string]string{}), start.Add(time.Second)), ShouldBeEmpty)
+		So(d.add("task", gate, dedupMetric("link down", map[string]string{}), start.Add(2*time.Second)), ShouldBeEmpty)
+		So(d.add("task", gate, dedupMetric("link down", map[string]string{}), start.Add(3*time.Second)), ShouldBeEmpty)
+
+		So(d.flush("task", start.Add(30*time.Second)), ShouldBeEmpty)
+		So(d.flush("other", start.Add(time.Hour)), ShouldBeEmpty)
+
+		metrics := d.flush("task", start.Add(time.Minute))
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Data, ShouldEqual, "link down")
+		So(metrics[0].Tags[defaultDedupTag], ShouldEqual, "3")
+
+		metrics = d.flush("task", start.Add(2 * time.Minute))
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Data, ShouldEqual, "link up")
+		So(metrics[0].Tags[defaultDedupTag], ShouldEqual, "1")
+	})
+
+	Convey("Test deduplicating by tags within max_entries", t, func() {
+		settings, err := compileGateDedup(map[interface{}]interface{}{
+			configDedupBy:         []interface{}{"service"},
+			configDedupMaxEntries: 2,
+			configDedupTag:        "repeats",
+		})
+		So(err, ShouldBeNil)
+		gate := internalConfig{Name: "errors", Dedup: settings}
+		d := newDeduplicator()
+		now := time.Now()
+
+		So(d.add("task", gate, dedupMetric("a", map[string]string{"service": "api"}), now), ShouldBeEmpty)
+		So(d.add("task", gate, dedupMetric("b", map[string]string{"service": "api"}), now), ShouldBeEmpty)
+		So(d.add("task", gate, dedupMetric("c", map[string]string{"service": "web"}), now), ShouldBeEmpty)
+
+		evicted := d.add("task", gate, dedupMetric("d", map[string]string{"service": "db"}), now)
+		So(len(evicted), ShouldEqual, 1)
+		So(evicted[0].Data, ShouldEqual, "a")
+		So(evicted[0].Tags["repeats"], ShouldEqual, "2")
+	})
+
+	Convey("Test bad dedup configs are rejected", t, func() {
+		_, err := compileGateDedup("yes")
+		So(err, ShouldNotBeNil)
+		_, err = compileGateDedup(map[interface{}]interface{}{configDedupMaxEntries: 0})
+		So(err, ShouldNotBeNil)
+		_, err = compileGateDedup(map[interface{}]interface{}{configDedupWindow: "-1s"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test dedup in Process", t, func() {
+		config := plugin.Config{
+			"^link": `{parse: ['^link (?P<state>\S+)'], dedup: {window: 1ns}}`,
+		}
+		mts := []plugin.Metric{
+			dedupMetric("link down", map[string]string{}),
+			dedupMetric("link down", map[string]string{}),
+			dedupMetric("other line", map[string]string{}),
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Data, ShouldEqual, "other line")
+
+		time.Sleep(time.Millisecond)
+		metrics, err = newPlugin.Process(nil, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Tags["state"], ShouldEqual, "down")
+		So(metrics[0].Tags[defaultDedupTag], ShouldEqual, "2")
+
+		Convey("keeping each task's repeats to itself", func() {
+			other := plugin.Config{
+				"^link": `{parse: ['^link (?P<state>\S+)'], dedup: {window: 1ns, tag: repeats}}`,
+			}
+			metrics, err := newPlugin.Process(mts[:1], config)
+			So(err, ShouldBeNil)
+			So(metrics, ShouldBeEmpty)
+
+			time.Sleep(time.Millisecond)
+			metrics, err = newPlugin.Process(nil, other)
+			So(err, ShouldBeNil)
+			So(metrics, ShouldBeEmpty)
+
+			metrics, err = newPlugin.Process(nil, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Tags[defaultDedupTag], ShouldEqual, "1")
+		})
+	})
+}
@@ -0,0 +1,132 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// What to do about a metric a gate fails to process
+const (
+	// errorFailBatch fails the whole Process call
+	errorFailBatch = "fail_batch"
+	// errorDropMetric drops the metric
+	errorDropMetric = "drop_metric"
+	// errorPassOriginal passes on the metric as it was
+	// before the gate, or the piece of it, if split
+	errorPassOriginal = "pass_original"
+	// errorTagError passes on the metric as far as it
+	// got, with a tag holding the error
+	errorTagError = "tag_error"
+	// errorDeadLetter passes on the metric as it was
+	// before the gate, under the dead letter namespace
+	errorDeadLetter = "dead_letter"
+
+	defaultErrorTag = "error"
+
+	// Tags of dead letters
+	deadLetterGateTag  = "gate"
+	deadLetterStageTag = "stage"
+	deadLetterErrorTag = "error"
+)
+
+var defaultDeadLetterSuffix = []string{"dead_letter"}
+
+// Stages of processing a metric that can fail
+const (
+	stageParse    = "parse"
+	stageTemplate = "template"
+)
+
+// stageError is an error in a stage of processing a metric
+type stageError struct {
+	Gate  string
+	Stage string
+	Err   error
+}
+
+func (e stageError) Error() string {
+	return fmt.Sprintf("Gate %q: %v failed: %v", e.Gate, e.Stage, e.Err)
+}
+
+func validateErrorPolicy(policy string) error {
+	switch policy {
+	case errorFailBatch, errorDropMetric, errorPassOriginal, errorTagError, errorDeadLetter:
+		return nil
+	}
+	return fmt.Errorf("%v must be one of %v, %v, %v, %v or %v, not %q", configOnError, errorFailBatch, errorDropMetric, errorPassOriginal, errorTagError, errorDeadLetter, policy)
+}
+
+// compileErrorPolicy reads the on_error and error_tag values, either
+// of which may be nil, keeping policy and tag as they are if unset
+func compileErrorPolicy(iPolicy interface{}, iTag interface{}, policy *string, tag *string) error {
+	var ok bool
+	if iPolicy != nil {
+		*policy, ok = iPolicy.(string)
+		if !ok {
+			return fmt.Errorf("%v must be a string, not a %T", configOnError, iPolicy)
+		}
+		err := validateErrorPolicy(*policy)
+		if err != nil {
+			return err
+		}
+	}
+	if iTag != nil {
+		*tag, ok = iTag.(string)
+		if !ok || *tag == "" {
+			return fmt.Errorf("%v must be a non-empty string", configErrorTag)
+		}
+	}
+	return nil
+}
+
+// errorPolicy returns what to do about an error in a stage, and
+// the tag to record it in. For parse failures, parse_failure takes
+// precedence over on_error.
+func (c internalConfig) errorPolicy(stage string) (string, string) {
+	if stage == stageParse {
+		switch c.ParseFailure {
+		case parseFailureDrop:
+			return errorDropMetric, ""
+		case parseFailureTag:
+			return errorTagError, c.ParseFailureTag
+		}
+	}
+	return c.OnError, c.ErrorTag
+}
+
+// deadLetter returns the metric as it was before the gate, with
+// the dead letter suffix added to its namespace and tags saying
+// where and why it failed
+func (c internalConfig) deadLetter(n plugin.Metric, stage string, err error) plugin.Metric {
+	namespace := append(n.Namespace.Strings(), c.DeadLetterSuffix...)
+	n.Namespace = plugin.NewNamespace(namespace...)
+
+	tags := make(map[string]string, len(n.Tags)+3)
+	for k, v := range n.Tags {
+		tags[k] = v
+	}
+	tags[deadLetterGateTag] = c.Name
+	tags[deadLetterStageTag] = stage
+	tags[deadLetterErrorTag] = err.Error()
+	n.Tags = tags
+	return n
+}
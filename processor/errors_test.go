@@ -0,0 +1,197 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	newMetrics := func() []plugin.Metric {
+		var mts []plugin.Metric
+		for _, line := range []string{"GET /a 200", "GET /b", "GET /c 500"} {
+			mts = append(mts, plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"host": "web1"},
+				Data:      line,
+			})
+		}
+		return mts
+	}
+	// /b fails to parse, and /c fails its template
+	gateCfg := func(extra string) string {
+		return `
+parse:
+  - '^GET (?P<path>\S+)'
+  - regex: ' (?P<status>[0-9]+)$'
+    required: true
+tags:
+  level: '{{ if eq .Tags.status "500" }}{{ .Nope.Nope }}{{ else }}info{{ end }}'
+` + extra
+	}
+
+	Convey("Test drop_metric is the default", t, func() {
+		metrics, err := New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("")})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Tags["path"], ShouldEqual, "/a")
+	})
+
+	Convey("Test pass_original", t, func() {
+		metrics, err := New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("on_error: pass_original")})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+		So(metrics[1].Tags, ShouldResemble, map[string]string{"host": "web1"})
+		So(metrics[2].Tags, ShouldResemble, map[string]string{"host": "web1"})
+		So(metrics[2].Data, ShouldEqual, "GET /c 500")
+	})
+
+	Convey("Test failed metrics skip counters and aggregates", t, func() {
+		metrics, err := New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("on_error: pass_original\nemit_counters: {replace: true}")})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+		So(metrics[0].Data, ShouldEqual, "GET /b")
+		So(metrics[1].Data, ShouldEqual, "GET /c 500")
+		So(metrics[2].Namespace.Strings(), ShouldResemble, defaultCounterNamespace)
+		So(metrics[2].Data, ShouldEqual, 1)
+
+		metrics, err = New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("on_error: tag_error\naggregate: {value: status, stats: [count]}")})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[0].Tags["path"], ShouldEqual, "/b")
+		So(metrics[0].Tags[defaultErrorTag], ShouldNotBeEmpty)
+		So(metrics[1].Tags["status"], ShouldEqual, "500")
+		So(metrics[1].Tags[defaultErrorTag], ShouldNotBeEmpty)
+	})
+
+	Convey("Test template failures of split pieces pass on the piece", t, func() {
+		mts := []plugin.Metric{{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      map[string]string{"host": "web1"},
+			Data:      "codes 200 500 404",
+		}}
+		gate := `
+parse: ['(?P<code>[0-9]+)']
+parse_all: split
+tags:
+  bad: '{{ .Nope.Nope }}'
+`
+		for _, policy := range []string{errorPassOriginal, errorDeadLetter} {
+			metrics, err := New().Process(mts, plugin.Config{"^codes": gate + "on_error: " + policy})
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			for idx, code := range []string{"200", "500", "404"} {
+				So(metrics[idx].Data, ShouldEqual, code)
+				So(metrics[idx].Tags["host"], ShouldEqual, "web1")
+			}
+		}
+	})
+
+	Convey("Test tag_error from the top level", t, func() {
+		config := plugin.Config{
+			configOnError:  errorTagError,
+			configErrorTag: "oops",
+			"^GET":         gateCfg(""),
+		}
+		metrics, err := New().Process(newMetrics(), config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+		So(metrics[0].Tags, ShouldNotContainKey, "oops")
+		So(metrics[1].Tags["path"], ShouldEqual, "/b")
+		So(metrics[1].Tags["oops"], ShouldNotBeEmpty)
+		So(metrics[2].Tags["status"], ShouldEqual, "500")
+		So(metrics[2].Tags, ShouldNotContainKey, "level")
+		So(metrics[2].Tags["oops"], ShouldContainSubstring, "Nope")
+	})
+
+	Convey("Test parse_failure takes precedence for parse failures", t, func() {
+		metrics, err := New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("on_error: pass_original\nparse_failure: drop")})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[1].Data, ShouldEqual, "GET /c 500")
+	})
+
+	Convey("Test dead_letter", t, func() {
+		config := plugin.Config{
+			configDeadLetterSuffix: "/failed/lines",
+			"^GET":                 gateCfg("name: requests\non_error: dead_letter"),
+		}
+		metrics, err := New().Process(newMetrics(), config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+		So(metrics[0].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "metric", "log", "message"})
+
+		So(metrics[1].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "metric", "log", "message", "failed", "lines"})
+		So(metrics[1].Data, ShouldEqual, "GET /b")
+		So(metrics[1].Tags["host"], ShouldEqual, "web1")
+		So(metrics[1].Tags[deadLetterGateTag], ShouldEqual, "requests")
+		So(metrics[1].Tags[deadLetterStageTag], ShouldEqual, stageParse)
+		So(metrics[1].Tags[deadLetterErrorTag], ShouldNotBeEmpty)
+		So(metrics[1].Tags, ShouldNotContainKey, "path")
+
+		So(metrics[2].Namespace.Strings(), ShouldResemble, []string{"intel", "logs", "metric", "log", "message", "failed", "lines"})
+		So(metrics[2].Tags[deadLetterStageTag], ShouldEqual, stageTemplate)
+		So(metrics[2].Tags, ShouldNotContainKey, "status")
+
+		Convey("skipping counters and aggregates", func() {
+			config["^GET"] = gateCfg("name: requests\non_error: dead_letter\nemit_counters: {replace: true}\naggregate: {value: status}")
+			metrics, err := New().Process(newMetrics(), config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 3)
+			So(metrics[0].Tags[deadLetterStageTag], ShouldEqual, stageParse)
+			So(metrics[1].Tags[deadLetterStageTag], ShouldEqual, stageTemplate)
+			So(metrics[2].Namespace.Strings(), ShouldResemble, defaultCounterNamespace)
+			So(metrics[2].Data, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Test fail_batch", t, func() {
+		metrics, err := New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("on_error: fail_batch")})
+		So(metrics, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, stageParse)
+
+		Convey("keeping the stats of the failed batch", func() {
+			newPlugin := New()
+			config := plugin.Config{"^GET": gateCfg("name: requests\non_error: fail_batch")}
+			_, err := newPlugin.Process(newMetrics(), config)
+			So(err, ShouldNotBeNil)
+			stats := newPlugin.stats.configs[configID(config)]["requests"]
+			So(stats.In, ShouldEqual, 2)
+			So(stats.ParseFailures, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Test bad error policies are rejected", t, func() {
+		_, err := New().Process(newMetrics(), plugin.Config{configOnError: "ignore", "^GET": gateCfg("")})
+		So(err, ShouldNotBeNil)
+		_, err = New().Process(newMetrics(), plugin.Config{"^GET": gateCfg("error_tag: ''")})
+		So(err, ShouldNotBeNil)
+		_, err = New().Process(newMetrics(), plugin.Config{configDeadLetterSuffix: "a//b", "^GET": gateCfg("")})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,74 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// fileCache keeps what was loaded from local files between Process
+// calls, loading them again only when they change on disk. A nil
+// fileCache loads the file every time.
+type fileCache struct {
+	sync.Mutex
+	entries map[string]*cachedFile
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	value   interface{}
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{entries: make(map[string]*cachedFile)}
+}
+
+// load returns what loader made of the file at path. key tells apart
+// different loaders of the same file.
+func (c *fileCache) load(key string, path string, loader func(path string) (interface{}, error)) (interface{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return loader(path)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	key = key + ":" + path
+	cached, ok := c.entries[key]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.value, nil
+	}
+
+	value, err := loader(path)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = &cachedFile{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		value:   value,
+	}
+	return value, nil
+}
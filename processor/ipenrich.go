@@ -0,0 +1,294 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	configIPTag    = "tag"
+	configIPPrefix = "prefix"
+
+	// Tags set by IP enrichment, after the prefix
+	ipClassTag       = "class"
+	ipNetworkTag     = "network"
+	ipCountryTag     = "country"
+	ipCountryNameTag = "country_name"
+	ipCityTag        = "city"
+	ipASNTag         = "asn"
+	ipASOrgTag       = "as_org"
+
+	// Language of the GeoIP names we use
+	geoipLanguage = "en"
+)
+
+// Classes of IP addresses
+const (
+	ipClassLoopback    = "loopback"
+	ipClassPrivate     = "private"
+	ipClassLinkLocal   = "link_local"
+	ipClassMulticast   = "multicast"
+	ipClassUnspecified = "unspecified"
+	ipClassPublic      = "public"
+)
+
+var privateNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+// ipEnricher classifies IP addresses and looks them up in the
+// GeoIP databases
+type ipEnricher struct {
+	// Networks are sorted most specific first
+	Networks  []namedNetwork
+	Databases []*maxminddb.Reader
+}
+
+type namedNetwork struct {
+	Name    string
+	Network *net.IPNet
+}
+
+// gateIPEnrich enriches the IP address in the Tag tag, storing
+// what it finds in tags starting with Prefix
+type gateIPEnrich struct {
+	Tag      string
+	Prefix   string
+	Enricher *ipEnricher
+}
+
+// geoipRecord holds the fields we use from both City or Country
+// databases and ASN databases
+type geoipRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// compileIPEnricher reads the named networks and opens the GeoIP
+// databases; either may be nil
+func compileIPEnricher(networksFrom interface{}, databasesFrom interface{}, files *fileCache) (*ipEnricher, error) {
+	enricher := &ipEnricher{}
+
+	if networksFrom != nil {
+		decoded, err := decodeConfigValue(networksFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configIPNetworks, err)
+		}
+		rawNetworks, ok := decoded.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be a dict, not a %T", configIPNetworks, decoded)
+		}
+		for iName, iCIDRs := range rawNetworks {
+			name, ok := iName.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v name isn't a string, but a %T with value %v", configIPNetworks, iName, iName)
+			}
+			var rawCIDRs []interface{}
+			switch v := iCIDRs.(type) {
+			case string:
+				rawCIDRs = []interface{}{v}
+			case []interface{}:
+				rawCIDRs = v
+			default:
+				return nil, fmt.Errorf("%v of %v must be a string or a list, not a %T", configIPNetworks, name, iCIDRs)
+			}
+			for _, iCIDR := range rawCIDRs {
+				cidr, _ := iCIDR.(string)
+				_, network, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("%v of %v: %v", configIPNetworks, name, err)
+				}
+				enricher.Networks = append(enricher.Networks, namedNetwork{Name: name, Network: network})
+			}
+		}
+		sort.Slice(enricher.Networks, func(i, j int) bool {
+			iOnes, _ := enricher.Networks[i].Network.Mask.Size()
+			jOnes, _ := enricher.Networks[j].Network.Mask.Size()
+			if iOnes != jOnes {
+				return iOnes > jOnes
+			}
+			return enricher.Networks[i].Name < enricher.Networks[j].Name
+		})
+	}
+
+	if databasesFrom != nil {
+		decoded, err := decodeConfigValue(databasesFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configGeoIPDatabase, err)
+		}
+		var paths []interface{}
+		switch v := decoded.(type) {
+		case string:
+			paths = []interface{}{v}
+		case []interface{}:
+			paths = v
+		default:
+			return nil, fmt.Errorf("%v must be a string or a list of them, not a %T with value %v", configGeoIPDatabase, decoded, decoded)
+		}
+		for _, iPath := range paths {
+			path, ok := iPath.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v path must be a string, not a %T with value %v", configGeoIPDatabase, iPath, iPath)
+			}
+			loaded, err := files.load("geoip", path, loadGeoIPDatabase)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", configGeoIPDatabase, err)
+			}
+			enricher.Databases = append(enricher.Databases, loaded.(*maxminddb.Reader))
+		}
+	}
+
+	return enricher, nil
+}
+
+// loadGeoIPDatabase reads the whole database into memory rather than
+// mapping it, so that a replaced database is simply garbage collected
+func loadGeoIPDatabase(path string) (interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return maxminddb.FromBytes(content)
+}
+
+func compileGateIPEnrich(from interface{}, enricher *ipEnricher) ([]gateIPEnrich, error) {
+	rawEntries, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configIPEnrich, from)
+	}
+
+	var entries []gateIPEnrich
+	for _, iEntry := range rawEntries {
+		entry := gateIPEnrich{Enricher: enricher}
+		switch v := iEntry.(type) {
+		case string:
+			entry.Tag = v
+			entry.Prefix = v + "_"
+		case map[interface{}]interface{}:
+			entry.Tag, _ = v[configIPTag].(string)
+			entry.Prefix = entry.Tag + "_"
+			if iPrefix, ok := v[configIPPrefix]; ok {
+				entry.Prefix, ok = iPrefix.(string)
+				if !ok {
+					return nil, fmt.Errorf("%v %v must be a string, not a %T", configIPEnrich, configIPPrefix, iPrefix)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%v entry not a string or a dict but %T with value %v", configIPEnrich, iEntry, iEntry)
+		}
+		if entry.Tag == "" {
+			return nil, fmt.Errorf("%v entry needs a %v", configIPEnrich, configIPTag)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// classifyIP returns the class of an IP address
+func classifyIP(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return ipClassLoopback
+	case ip.IsUnspecified():
+		return ipClassUnspecified
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return ipClassLinkLocal
+	case ip.IsMulticast():
+		return ipClassMulticast
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return ipClassPrivate
+		}
+	}
+	return ipClassPublic
+}
+
+// enrich returns the tags describing an IP address, without prefix
+func (e *ipEnricher) enrich(ip net.IP) map[string]string {
+	tags := map[string]string{
+		ipClassTag: classifyIP(ip),
+	}
+
+	for _, network := range e.Networks {
+		if network.Network.Contains(ip) {
+			tags[ipNetworkTag] = network.Name
+			break
+		}
+	}
+
+	for _, database := range e.Databases {
+		var record geoipRecord
+		err := database.Lookup(ip, &record)
+		if err != nil {
+			continue
+		}
+		if record.Country.ISOCode != "" {
+			tags[ipCountryTag] = record.Country.ISOCode
+		}
+		if name := record.Country.Names[geoipLanguage]; name != "" {
+			tags[ipCountryNameTag] = name
+		}
+		if name := record.City.Names[geoipLanguage]; name != "" {
+			tags[ipCityTag] = name
+		}
+		if record.ASN != 0 {
+			tags[ipASNTag] = strconv.FormatUint(uint64(record.ASN), 10)
+		}
+		if record.ASOrg != "" {
+			tags[ipASOrgTag] = record.ASOrg
+		}
+	}
+	return tags
+}
+
+// apply sets the tags describing the IP address in the entry's tag
+func (g gateIPEnrich) apply(tags map[string]string) {
+	ip := net.ParseIP(tags[g.Tag])
+	if ip == nil {
+		return
+	}
+	for tag, value := range g.Enricher.enrich(ip) {
+		tags[g.Prefix+tag] = value
+	}
+}
@@ -0,0 +1,153 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// A tiny database with 1.2.3.0/24 in Sydney, Australia, on
+// AS13335, and 8.8.8.0/24 in the United States
+const testGeoIPDatabase = "testdata/test-geoip.mmdb"
+
+func TestIPEnrichment(t *testing.T) {
+	Convey("Test classifying IP addresses", t, func() {
+		So(classifyIP(net.ParseIP("127.0.0.1")), ShouldEqual, ipClassLoopback)
+		So(classifyIP(net.ParseIP("::1")), ShouldEqual, ipClassLoopback)
+		So(classifyIP(net.ParseIP("10.1.2.3")), ShouldEqual, ipClassPrivate)
+		So(classifyIP(net.ParseIP("172.20.0.1")), ShouldEqual, ipClassPrivate)
+		So(classifyIP(net.ParseIP("fd00::1")), ShouldEqual, ipClassPrivate)
+		So(classifyIP(net.ParseIP("169.254.1.1")), ShouldEqual, ipClassLinkLocal)
+		So(classifyIP(net.ParseIP("224.0.0.251")), ShouldEqual, ipClassLinkLocal)
+		So(classifyIP(net.ParseIP("239.1.1.1")), ShouldEqual, ipClassMulticast)
+		So(classifyIP(net.ParseIP("0.0.0.0")), ShouldEqual, ipClassUnspecified)
+		So(classifyIP(net.ParseIP("8.8.8.8")), ShouldEqual, ipClassPublic)
+	})
+
+	Convey("Test enriching IP addresses", t, func() {
+		enricher, err := compileIPEnricher(
+			map[string]interface{}{
+				"office": []string{"10.1.0.0/16"},
+				"lab":    "10.1.2.0/24",
+			},
+			testGeoIPDatabase,
+			nil,
+		)
+		So(err, ShouldBeNil)
+
+		Convey("The most specific named network wins", func() {
+			So(enricher.enrich(net.ParseIP("10.1.2.3"))[ipNetworkTag], ShouldEqual, "lab")
+			So(enricher.enrich(net.ParseIP("10.1.3.3"))[ipNetworkTag], ShouldEqual, "office")
+			So(enricher.enrich(net.ParseIP("10.2.3.3")), ShouldNotContainKey, ipNetworkTag)
+		})
+
+		Convey("GeoIP fields come from the database", func() {
+			So(enricher.enrich(net.ParseIP("1.2.3.4")), ShouldResemble, map[string]string{
+				ipClassTag:       ipClassPublic,
+				ipCountryTag:     "AU",
+				ipCountryNameTag: "Australia",
+				ipCityTag:        "Sydney",
+				ipASNTag:         "13335",
+				ipASOrgTag:       "Example Net",
+			})
+			So(enricher.enrich(net.ParseIP("8.8.8.8")), ShouldResemble, map[string]string{
+				ipClassTag:       ipClassPublic,
+				ipCountryTag:     "US",
+				ipCountryNameTag: "United States",
+			})
+			So(enricher.enrich(net.ParseIP("9.9.9.9")), ShouldResemble, map[string]string{
+				ipClassTag: ipClassPublic,
+			})
+		})
+
+		Convey("The databases can be a list, as a string or natively", func() {
+			for _, databases := range []interface{}{
+				"[" + testGeoIPDatabase + "]",
+				`["` + testGeoIPDatabase + `"]`,
+				[]string{testGeoIPDatabase},
+			} {
+				enricher, err := compileIPEnricher(nil, databases, nil)
+				So(err, ShouldBeNil)
+				So(enricher.Databases, ShouldHaveLength, 1)
+			}
+		})
+
+		Convey("Bad configs are rejected", func() {
+			_, err := compileIPEnricher(nil, 3, nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileIPEnricher(nil, "{path: x}", nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "must be a string")
+			_, err = compileIPEnricher(map[string]interface{}{"x": "not a network"}, nil, nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileIPEnricher(nil, "testdata/missing.mmdb", nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileIPEnricher(nil, "ipenrich.go", nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileGateIPEnrich([]interface{}{map[interface{}]interface{}{configIPPrefix: "x"}}, enricher)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test IP enrichment in a gate", t, func() {
+		gateCfg := `
+parse:
+  - '^(?P<client>\S+) (?P<upstream>\S+) '
+ip_enrich:
+  - client
+  - tag: upstream
+    prefix: "up."
+`
+		config := plugin.Config{
+			configGeoIPDatabase: testGeoIPDatabase,
+			configIPNetworks:    "backends: [10.0.0.0/24]",
+			"^":                 gateCfg,
+		}
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "1.2.3.4 10.0.0.5 GET /",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "- - GET /",
+			},
+		}
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[0].Tags["client_class"], ShouldEqual, ipClassPublic)
+		So(metrics[0].Tags["client_country"], ShouldEqual, "AU")
+		So(metrics[0].Tags["client_city"], ShouldEqual, "Sydney")
+		So(metrics[0].Tags["up.class"], ShouldEqual, ipClassPrivate)
+		So(metrics[0].Tags["up.network"], ShouldEqual, "backends")
+		So(metrics[1].Tags, ShouldNotContainKey, "client_class")
+	})
+}
@@ -0,0 +1,412 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"text/template"
+	tplparse "text/template/parse"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+// Checks the linter makes
+const (
+	// LintOverlapped reports gates that process every metric an
+	// earlier gate processes
+	LintOverlapped = "overlapped"
+	// LintUnnamedGroups reports parse regexes that set no tags
+	LintUnnamedGroups = "unnamed_groups"
+	// LintUnknownTag reports templates using tags the gate never sets
+	LintUnknownTag = "unknown_tag"
+	// LintDuplicateCapture reports tags captured by more than one
+	// parse regex of a gate
+	LintDuplicateCapture = "duplicate_capture"
+	// LintSplitFanOut reports splits that cut metrics into pieces
+	// at nearly every character
+	LintSplitFanOut = "split_fan_out"
+	// LintUnanchored reports gate regexes that start with neither
+	// an anchor nor a literal
+	LintUnanchored = "unanchored"
+)
+
+// LintChecks are all the checks the linter makes
+var LintChecks = []string{LintOverlapped, LintUnnamedGroups, LintUnknownTag, LintDuplicateCapture, LintSplitFanOut, LintUnanchored}
+
+// fanOutProbes are single characters a split regex shouldn't match,
+// or it cuts words and numbers apart
+var fanOutProbes = []string{"a", "Z", "0"}
+
+// indexSuffix is the suffix parse_all: index adds to tag names
+var indexSuffix = regexp.MustCompile(`_[0-9]+$`)
+
+// LintFinding is a likely mistake in a gate
+type LintFinding struct {
+	Gate    string
+	Check   string
+	Message string
+}
+
+// Lint compiles the config and reports likely mistakes in its gates,
+// in the order of the gates
+func Lint(cfg plugin.Config) ([]LintFinding, error) {
+	pluginCfg, err := parseConfig(cfg, newFileCache())
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []LintFinding
+	for idx, gate := range pluginCfg.Gates {
+		add := func(check string, format string, args ...interface{}) {
+			findings = append(findings, LintFinding{
+				Gate:    gate.Name,
+				Check:   check,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		for _, earlier := range pluginCfg.Gates[:idx] {
+			if earlier.overlaps(gate) {
+				add(LintOverlapped, "Every metric it matches is also processed by gate %q, listed before it", earlier.Name)
+				break
+			}
+		}
+
+		if !startsWithAnchorOrLiteral(gate.Match) {
+			add(LintUnanchored, "Regex %q starts with neither an anchor nor a literal, so it's tried at every position", gate.Match.String())
+		}
+
+		for _, regex := range gate.Split {
+			if splitFansOut(regex) {
+				add(LintSplitFanOut, "Split regex %q matches the empty string or any letter or digit, so it cuts metrics into pieces at nearly every character", regex.String())
+			}
+		}
+
+		capturedBy := make(map[string]int)
+		for ruleIdx, rule := range gate.Parse {
+			named := false
+			for i, name := range rule.Regex.SubexpNames() {
+				if i == 0 || name == "" {
+					continue
+				}
+				named = true
+				tag := rule.tagName(name)
+				// Only one first_match regex sets tags, so
+				// alternatives may well capture the same ones
+				if first, ok := capturedBy[tag]; ok && first != ruleIdx && gate.ParseMode != parseModeFirstMatch {
+					add(LintDuplicateCapture, "Tag %q is captured by parse regexes %d and %d", tag, first+1, ruleIdx+1)
+					continue
+				}
+				capturedBy[tag] = ruleIdx
+			}
+			// Splitting by parse regex needs no tags
+			if !named && gate.ParseAll != parseAllSplit {
+				add(LintUnnamedGroups, "Parse regex %d %q has no named groups, so it sets no tags", ruleIdx+1, rule.Regex.String())
+			}
+		}
+
+		if gate.Template != nil {
+			produced := gate.producedTags(pluginCfg.GateTag)
+			for _, ref := range templateTagRefs(gate.Template.Templates()) {
+				if !produced.has(ref.Tag) {
+					add(LintUnknownTag, "Template of tag %q uses tag %q, which the gate doesn't set before its templates run", ref.Template, ref.Tag)
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// overlaps reports whether the gate processes every metric other does,
+// as far as can be told from their selectors and regexes
+func (c internalConfig) overlaps(other internalConfig) bool {
+	if c.Match.String() != other.Match.String() && !matchesEverything(c.Match) {
+		return false
+	}
+
+	if len(c.Namespaces) > 0 {
+		selected := make(map[string]bool, len(c.Namespaces))
+		for _, ns := range c.Namespaces {
+			selected[strings.Join(ns, "/")] = true
+		}
+		if len(other.Namespaces) == 0 {
+			return false
+		}
+		for _, ns := range other.Namespaces {
+			if !selected[strings.Join(ns, "/")] {
+				return false
+			}
+		}
+	}
+
+	for tag, regex := range c.Tags {
+		otherRegex, ok := other.Tags[tag]
+		if !ok || otherRegex.String() != regex.String() {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesEverything reports whether the regex matches every string:
+// it does if it matches the empty string and has no assertions bar
+// leading ^ or \A, which hold at the start of any string
+func matchesEverything(regex *regexp.Regexp) bool {
+	if !regex.MatchString("") {
+		return false
+	}
+	re, err := syntax.Parse(regex.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	re = re.Simplify()
+	if re.Op == syntax.OpConcat {
+		subs := re.Sub
+		for len(subs) > 0 && (subs[0].Op == syntax.OpBeginText || subs[0].Op == syntax.OpBeginLine) {
+			subs = subs[1:]
+		}
+		for _, sub := range subs {
+			if hasAssertion(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return re.Op == syntax.OpBeginText || re.Op == syntax.OpBeginLine || !hasAssertion(re)
+}
+
+func hasAssertion(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasAssertion(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsWithAnchorOrLiteral reports whether every match of the regex
+// starts with an anchor or a literal
+func startsWithAnchorOrLiteral(regex *regexp.Regexp) bool {
+	re, err := syntax.Parse(regex.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return startsWith(re.Simplify())
+}
+
+func startsWith(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpBeginText, syntax.OpLiteral:
+		return true
+	case syntax.OpCapture, syntax.OpPlus:
+		return startsWith(re.Sub[0])
+	case syntax.OpConcat:
+		return len(re.Sub) > 0 && startsWith(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !startsWith(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// splitFansOut reports whether a split regex matches the empty string,
+// splitting between every character, or any letter or digit
+func splitFansOut(regex *regexp.Regexp) bool {
+	if regex.MatchString("") {
+		return true
+	}
+	for _, probe := range fanOutProbes {
+		if !regex.MatchString(probe) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagSet is the tags a gate may set, by name or by prefix
+type tagSet struct {
+	names    map[string]bool
+	prefixes []string
+}
+
+func (s tagSet) has(tag string) bool {
+	if s.names[tag] || s.names[indexSuffix.ReplaceAllString(tag, "")] {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// producedTags returns the tags the gate may have set by the time its
+// templates run: those its selectors require, its captures, error tags,
+// the gate tag and those set by its lookups and enrichments
+func (c internalConfig) producedTags(gateTag string) tagSet {
+	produced := tagSet{names: make(map[string]bool)}
+	add := func(prefix string, names ...string) {
+		for _, name := range names {
+			produced.names[prefix+name] = true
+		}
+	}
+
+	for tag := range c.Tags {
+		add("", tag)
+	}
+	for _, rule := range c.Parse {
+		for i, name := range rule.Regex.SubexpNames() {
+			if i != 0 && name != "" {
+				add("", rule.tagName(name))
+			}
+		}
+	}
+	if gateTag != "" {
+		add("", gateTag)
+	}
+	if policy, tag := c.errorPolicy(stageParse); policy == errorTagError {
+		add("", tag)
+	}
+
+	for _, lookup := range c.Lookups {
+		if lookup.Columns != nil {
+			add(lookup.Prefix, lookup.Columns...)
+			continue
+		}
+		for _, row := range lookup.Table.Exact {
+			for column := range row {
+				add(lookup.Prefix, column)
+			}
+		}
+		for _, network := range lookup.Table.Networks {
+			for column := range network.Row {
+				add(lookup.Prefix, column)
+			}
+		}
+	}
+	for _, ipEnrich := range c.IPEnrich {
+		add(ipEnrich.Prefix, ipClassTag, ipNetworkTag, ipCountryTag, ipCountryNameTag, ipCityTag, ipASNTag, ipASOrgTag)
+	}
+	for _, userAgent := range c.UserAgent {
+		add(userAgent.Prefix, uaBrowserTag, uaBrowserVersionTag, uaOSTag, uaOSVersionTag, uaDeviceTag, uaBotTag)
+	}
+	for _, url := range c.URLs {
+		add(url.Prefix, urlHostTag, urlPathTag, urlRouteTag, urlFragmentTag)
+		produced.prefixes = append(produced.prefixes, url.Prefix+urlQueryTag+"_")
+	}
+	return produced
+}
+
+// templateTagRef is a tag a template uses
+type templateTagRef struct {
+	Template string
+	Tag      string
+}
+
+// templateTagRefs returns the tags the templates use, as .Tags.name
+// or index .Tags "name", sorted by template then tag
+func templateTagRefs(templates []*template.Template) []templateTagRef {
+	var refs []templateTagRef
+	for _, tpl := range templates {
+		if tpl.Name() == "" || tpl.Tree == nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		walkTemplate(tpl.Tree.Root, func(tag string) {
+			if !seen[tag] {
+				seen[tag] = true
+				refs = append(refs, templateTagRef{Template: tpl.Name(), Tag: tag})
+			}
+		})
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Template != refs[j].Template {
+			return refs[i].Template < refs[j].Template
+		}
+		return refs[i].Tag < refs[j].Tag
+	})
+	return refs
+}
+
+func walkTemplate(node tplparse.Node, found func(tag string)) {
+	switch n := node.(type) {
+	case *tplparse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplate(child, found)
+		}
+	case *tplparse.ActionNode:
+		walkTemplate(n.Pipe, found)
+	case *tplparse.IfNode:
+		walkBranch(&n.BranchNode, found)
+	case *tplparse.RangeNode:
+		walkBranch(&n.BranchNode, found)
+	case *tplparse.WithNode:
+		walkBranch(&n.BranchNode, found)
+	case *tplparse.TemplateNode:
+		walkTemplate(n.Pipe, found)
+	case *tplparse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, found)
+		}
+	case *tplparse.CommandNode:
+		// index .Tags "name"
+		if len(n.Args) >= 3 {
+			ident, isIdent := n.Args[0].(*tplparse.IdentifierNode)
+			field, isField := n.Args[1].(*tplparse.FieldNode)
+			name, isString := n.Args[2].(*tplparse.StringNode)
+			if isIdent && ident.Ident == "index" && isField && isString && len(field.Ident) == 1 && field.Ident[0] == "Tags" {
+				found(name.Text)
+			}
+		}
+		for _, arg := range n.Args {
+			walkTemplate(arg, found)
+		}
+	case *tplparse.FieldNode:
+		// .Tags.name
+		if len(n.Ident) >= 2 && n.Ident[0] == "Tags" {
+			found(n.Ident[1])
+		}
+	}
+}
+
+func walkBranch(n *tplparse.BranchNode, found func(tag string)) {
+	walkTemplate(n.Pipe, found)
+	walkTemplate(n.List, found)
+	walkTemplate(n.ElseList, found)
+}
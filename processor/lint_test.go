@@ -0,0 +1,144 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lintChecks returns the checks found, by gate
+func lintChecks(findings []LintFinding) map[string][]string {
+	checks := make(map[string][]string)
+	for _, finding := range findings {
+		checks[finding.Gate] = append(checks[finding.Gate], finding.Check)
+	}
+	return checks
+}
+
+func TestLint(t *testing.T) {
+	Convey("Test linting", t, func() {
+		Convey("passes clean configs", func() {
+			findings, err := Lint(plugin.Config{
+				configGateTag: "gate",
+				configGates: `
+- name: requests
+  match: "^GET "
+  split: ['\n']
+  parse: ['^GET (?P<path>\S+) (?P<status>[0-9]+)$']
+  url: [path]
+  tags:
+    route: '{{ .Tags.path_route }}'
+    failed: '{{ if eq (index .Tags "status") "500" }}{{ .Tags.gate }}{{ end }}'
+    param: '{{ .Tags.path_query_id }}'
+- name: errors
+  match: "(?i)error"
+  namespace: /intel/logs/*
+  match_tags: {source: nginx}
+  parse: ['(?P<level>ERROR)']
+  tags:
+    source: '{{ .Tags.source }}'
+- name: either
+  match: "^(GET|POST) "
+  parse_mode: first_match
+  parse: ['^GET (?P<path>\S+)', '^POST (?P<path>\S+)']
+`,
+			})
+			So(err, ShouldBeNil)
+			So(findings, ShouldBeEmpty)
+		})
+
+		Convey("reports likely mistakes", func() {
+			findings, err := Lint(plugin.Config{
+				configGates: `
+- name: everything
+  match: ".*"
+  parse: ['(?P<x>.)']
+- name: requests
+  match: "^GET "
+  split: ['\s*', '\w', ',']
+  parse: ['^GET (?P<path>\S+)', 'GET (\S+)', '(?P<path>/\S*)']
+  tags:
+    route: '{{ .Tags.path }}'
+    nope: '{{ .Tags.route }}{{ .Tags.nope }}'
+- name: requests again
+  match: "^GET "
+  namespace: /intel/logs/access
+  parse: ['(?P<m>GET)']
+`,
+			})
+			So(err, ShouldBeNil)
+			So(lintChecks(findings), ShouldResemble, map[string][]string{
+				"everything": {LintUnanchored},
+				"requests": {
+					LintOverlapped,
+					LintSplitFanOut, LintSplitFanOut,
+					LintUnnamedGroups,
+					LintDuplicateCapture,
+					LintUnknownTag, LintUnknownTag,
+				},
+				"requests again": {LintOverlapped},
+			})
+			So(findings[1].Message, ShouldContainSubstring, `gate "everything"`)
+			So(findings[5].Message, ShouldContainSubstring, "parse regexes 1 and 3")
+			So(findings[6].Message, ShouldContainSubstring, `tag "nope"`)
+			So(findings[7].Message, ShouldContainSubstring, `tag "route"`)
+		})
+
+		Convey("reports config errors", func() {
+			_, err := Lint(plugin.Config{"(": `{parse: []}`})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test regex analysis", t, func() {
+		for expr, everything := range map[string]bool{
+			"":       true,
+			".*":     true,
+			"^":      true,
+			"^.*":    true,
+			"(?s).*": true,
+			"x*":     true,
+			"^$":     false,
+			"^x*$":   false,
+			"\\bx*":  false,
+			"x":      false,
+		} {
+			So(matchesEverything(regexp.MustCompile(expr)), ShouldEqual, everything)
+		}
+
+		for expr, anchored := range map[string]bool{
+			"^GET":        true,
+			"GET":         true,
+			"(?i)error":   true,
+			"(GET|POST) ": true,
+			"x+y":         true,
+			".*error":     false,
+			"[a-z]+":      false,
+			"(GET|.)":     false,
+		} {
+			So(startsWithAnchorOrLiteral(regexp.MustCompile(expr)), ShouldEqual, anchored)
+		}
+	})
+}
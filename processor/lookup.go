@@ -0,0 +1,331 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	configLookupFile   = "file"
+	configLookupFormat = "format"
+	configLookupMatch  = "match"
+
+	configLookupTable = "table"
+	configLookupKey   = "key"
+	configLookupTags  = "tags"
+
+	// Column of single values in YAML and JSON tables
+	lookupValueColumn = "value"
+)
+
+// How the keys of a lookup table are matched
+const (
+	lookupExact  = "exact"
+	lookupPrefix = "prefix"
+	lookupCIDR   = "cidr"
+)
+
+// lookupTable maps keys to rows of named columns
+type lookupTable struct {
+	Match string
+	Exact map[string]map[string]string
+	// Prefixes are sorted longest first
+	Prefixes []string
+	// Networks are sorted most specific first
+	Networks []lookupNetwork
+}
+
+type lookupNetwork struct {
+	Network *net.IPNet
+	Row     map[string]string
+}
+
+// gateLookup sets the columns of the row found by the value of
+// the Key tag as tags
+type gateLookup struct {
+	Table   *lookupTable
+	Name    string
+	Key     string
+	Columns []string
+	Prefix  string
+}
+
+// compileLookupTables loads the tables defined in the top-level
+// lookups dict, by name
+func compileLookupTables(from interface{}, files *fileCache) (map[string]*lookupTable, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawTables, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be a dict of tables, not a %T", decoded)
+	}
+
+	tables := make(map[string]*lookupTable, len(rawTables))
+	for iName, iRawTable := range rawTables {
+		name, ok := iName.(string)
+		if !ok {
+			return nil, fmt.Errorf("Table name isn't a string, but a %T with value %v", iName, iName)
+		}
+		rawTable, ok := iRawTable.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Table %v must be a dict, not a %T", name, iRawTable)
+		}
+
+		path, ok := rawTable[configLookupFile].(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("Table %v needs a %v", name, configLookupFile)
+		}
+		format := strings.TrimPrefix(filepath.Ext(path), ".")
+		if iFormat, ok := rawTable[configLookupFormat]; ok {
+			format, ok = iFormat.(string)
+			if !ok {
+				return nil, fmt.Errorf("Table %v: %v must be a string, not a %T with value %v", name, configLookupFormat, iFormat, iFormat)
+			}
+		}
+		match := lookupExact
+		if iMatch, ok := rawTable[configLookupMatch]; ok {
+			match, ok = iMatch.(string)
+			if !ok {
+				return nil, fmt.Errorf("Table %v: %v must be a string, not a %T with value %v", name, configLookupMatch, iMatch, iMatch)
+			}
+		}
+		if match != lookupExact && match != lookupPrefix && match != lookupCIDR {
+			return nil, fmt.Errorf("Table %v: %v must be one of %v, %v or %v", name, configLookupMatch, lookupExact, lookupPrefix, lookupCIDR)
+		}
+
+		loaded, err := files.load("lookup:"+format+":"+match, path, func(path string) (interface{}, error) {
+			return loadLookupTable(path, format, match)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Table %v: %v", name, err)
+		}
+		tables[name] = loaded.(*lookupTable)
+	}
+	return tables, nil
+}
+
+// loadLookupTable reads a table from a CSV file, whose first column is
+// the key and whose header names the others, or from a YAML or JSON
+// dict of keys to either dicts of columns or single values
+func loadLookupTable(path string, format string, match string) (*lookupTable, error) {
+	rows := make(map[string]map[string]string)
+	switch format {
+	case "csv":
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) < 1 {
+			return nil, fmt.Errorf("CSV file has no header")
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]string, len(header)-1)
+			for i := 1; i < len(header) && i < len(record); i++ {
+				row[header[i]] = record[i]
+			}
+			rows[record[0]] = row
+		}
+	case "yaml", "yml", "json":
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := decodeConfigValue(string(content))
+		if err != nil {
+			return nil, err
+		}
+		rawRows, ok := decoded.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Table must be a dict, not a %T", decoded)
+		}
+		for iKey, iRow := range rawRows {
+			key := fmt.Sprint(iKey)
+			row := make(map[string]string)
+			if rawRow, ok := iRow.(map[interface{}]interface{}); ok {
+				for iColumn, iValue := range rawRow {
+					row[fmt.Sprint(iColumn)] = fmt.Sprint(iValue)
+				}
+			} else {
+				row[lookupValueColumn] = fmt.Sprint(iRow)
+			}
+			rows[key] = row
+		}
+	default:
+		return nil, fmt.Errorf("Unknown table format %q", format)
+	}
+
+	table := &lookupTable{Match: match}
+	switch match {
+	case lookupExact:
+		table.Exact = rows
+	case lookupPrefix:
+		table.Exact = rows
+		for key := range rows {
+			table.Prefixes = append(table.Prefixes, key)
+		}
+		sort.Slice(table.Prefixes, func(i, j int) bool {
+			return len(table.Prefixes[i]) > len(table.Prefixes[j])
+		})
+	case lookupCIDR:
+		for key, row := range rows {
+			if !strings.Contains(key, "/") {
+				if strings.Contains(key, ":") {
+					key += "/128"
+				} else {
+					key += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(key)
+			if err != nil {
+				return nil, err
+			}
+			table.Networks = append(table.Networks, lookupNetwork{Network: network, Row: row})
+		}
+		sort.Slice(table.Networks, func(i, j int) bool {
+			iOnes, _ := table.Networks[i].Network.Mask.Size()
+			jOnes, _ := table.Networks[j].Network.Mask.Size()
+			return iOnes > jOnes
+		})
+	}
+	return table, nil
+}
+
+// find returns the row for key, if any
+func (t *lookupTable) find(key string) (map[string]string, bool) {
+	switch t.Match {
+	case lookupPrefix:
+		for _, prefix := range t.Prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return t.Exact[prefix], true
+			}
+		}
+	case lookupCIDR:
+		ip := net.ParseIP(key)
+		if ip == nil {
+			return nil, false
+		}
+		for _, network := range t.Networks {
+			if network.Network.Contains(ip) {
+				return network.Row, true
+			}
+		}
+	default:
+		row, ok := t.Exact[key]
+		return row, ok
+	}
+	return nil, false
+}
+
+// lookupFunc is the lookup template function: it returns the column
+// of the row found for key in the named table, or an empty string
+func lookupFunc(tables map[string]*lookupTable) func(string, string, string) (string, error) {
+	return func(name string, key string, column string) (string, error) {
+		table, ok := tables[name]
+		if !ok {
+			return "", fmt.Errorf("No lookup table named %v", name)
+		}
+		row, _ := table.find(key)
+		return row[column], nil
+	}
+}
+
+func compileGateLookups(from interface{}, tables map[string]*lookupTable) ([]gateLookup, error) {
+	rawLookups, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configLookup, from)
+	}
+
+	var lookups []gateLookup
+	for _, iRawLookup := range rawLookups {
+		rawLookup, ok := iRawLookup.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v entry must be a dict, not a %T", configLookup, iRawLookup)
+		}
+		var lookup gateLookup
+		lookup.Name, _ = rawLookup[configLookupTable].(string)
+		lookup.Table, ok = tables[lookup.Name]
+		if !ok {
+			return nil, fmt.Errorf("No lookup table named %v", rawLookup[configLookupTable])
+		}
+		lookup.Key, ok = rawLookup[configLookupKey].(string)
+		if !ok || lookup.Key == "" {
+			return nil, fmt.Errorf("Lookup in %v needs a %v tag", lookup.Name, configLookupKey)
+		}
+		if iColumns, ok := rawLookup[configLookupTags]; ok {
+			rawColumns, ok := iColumns.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Lookup in %v: %v must be a list, not a %T", lookup.Name, configLookupTags, iColumns)
+			}
+			for _, iColumn := range rawColumns {
+				column, ok := iColumn.(string)
+				if !ok {
+					return nil, fmt.Errorf("Lookup in %v: column not a string but %T with value %v", lookup.Name, iColumn, iColumn)
+				}
+				lookup.Columns = append(lookup.Columns, column)
+			}
+		}
+		if iPrefix, ok := rawLookup[configPrefix]; ok {
+			lookup.Prefix, ok = iPrefix.(string)
+			if !ok {
+				return nil, fmt.Errorf("Lookup in %v: %v must be a string, not a %T", lookup.Name, configPrefix, iPrefix)
+			}
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, nil
+}
+
+// apply sets the looked up columns as tags
+func (l gateLookup) apply(tags map[string]string) {
+	key, ok := tags[l.Key]
+	if !ok {
+		return
+	}
+	row, ok := l.Table.find(key)
+	if !ok {
+		return
+	}
+	if l.Columns == nil {
+		for column, value := range row {
+			tags[l.Prefix+column] = value
+		}
+		return
+	}
+	for _, column := range l.Columns {
+		if value, ok := row[column]; ok {
+			tags[l.Prefix+column] = value
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupTables(t *testing.T) {
+	Convey("Test loading and using lookup tables", t, func() {
+		dir, err := ioutil.TempDir("", "regexp-engine-lookup")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		teams := filepath.Join(dir, "teams.csv")
+		So(ioutil.WriteFile(teams, []byte("host,team,owner\nweb1,frontend,alice\ndb1,storage,bob\n"), 0644), ShouldBeNil)
+		codes := filepath.Join(dir, "codes.yaml")
+		So(ioutil.WriteFile(codes, []byte("E1: disk full\nE2:\n  description: no route\n  severity: high\n"), 0644), ShouldBeNil)
+		paths := filepath.Join(dir, "paths.json")
+		So(ioutil.WriteFile(paths, []byte(`{"/api/": {"service": "api"}, "/api/v2/": {"service": "api2"}}`), 0644), ShouldBeNil)
+		networks := filepath.Join(dir, "networks.csv")
+		So(ioutil.WriteFile(networks, []byte("network,zone\n10.0.0.0/8,internal\n10.1.0.0/16,lab\n192.168.1.1,router\n"), 0644), ShouldBeNil)
+
+		lookupsCfg := map[string]interface{}{
+			"teams":    map[string]interface{}{configLookupFile: teams},
+			"codes":    map[string]interface{}{configLookupFile: codes},
+			"paths":    map[string]interface{}{configLookupFile: paths, configLookupMatch: lookupPrefix},
+			"networks": map[string]interface{}{configLookupFile: networks, configLookupMatch: lookupCIDR},
+		}
+		tables, err := compileLookupTables(lookupsCfg, nil)
+		So(err, ShouldBeNil)
+
+		Convey("Exact keys from CSV and YAML", func() {
+			row, ok := tables["teams"].find("web1")
+			So(ok, ShouldBeTrue)
+			So(row, ShouldResemble, map[string]string{"team": "frontend", "owner": "alice"})
+			_, ok = tables["teams"].find("web2")
+			So(ok, ShouldBeFalse)
+			row, _ = tables["codes"].find("E1")
+			So(row[lookupValueColumn], ShouldEqual, "disk full")
+			row, _ = tables["codes"].find("E2")
+			So(row["severity"], ShouldEqual, "high")
+		})
+
+		Convey("The longest prefix wins", func() {
+			row, _ := tables["paths"].find("/api/v2/users")
+			So(row["service"], ShouldEqual, "api2")
+			row, _ = tables["paths"].find("/api/v1/users")
+			So(row["service"], ShouldEqual, "api")
+		})
+
+		Convey("The most specific network wins", func() {
+			row, _ := tables["networks"].find("10.1.2.3")
+			So(row["zone"], ShouldEqual, "lab")
+			row, _ = tables["networks"].find("10.2.2.3")
+			So(row["zone"], ShouldEqual, "internal")
+			row, _ = tables["networks"].find("192.168.1.1")
+			So(row["zone"], ShouldEqual, "router")
+			_, ok := tables["networks"].find("not an ip")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Gates look up tags and templates call lookup", func() {
+			gateCfg := `
+parse:
+  - '^(?P<host>\S+) (?P<code>\S+)'
+lookup:
+  - table: teams
+    key: host
+    tags: [team]
+    prefix: "owner_"
+tags:
+  error: '{{ lookup "codes" .Tags.code "value" }}'
+`
+			config := plugin.Config{configLookups: lookupsCfg, "^": gateCfg}
+			mts := []plugin.Metric{
+				plugin.Metric{
+					Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+					Timestamp: time.Now(),
+					Tags:      map[string]string{},
+					Data:      "web1 E1",
+				},
+				plugin.Metric{
+					Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+					Timestamp: time.Now(),
+					Tags:      map[string]string{},
+					Data:      "web9 E9",
+				},
+			}
+			newPlugin := New()
+			metrics, err := newPlugin.Process(mts, config)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			So(metrics[0].Tags["owner_team"], ShouldEqual, "frontend")
+			So(metrics[0].Tags, ShouldNotContainKey, "owner_owner")
+			So(metrics[0].Tags["error"], ShouldEqual, "disk full")
+			So(metrics[1].Tags, ShouldNotContainKey, "owner_team")
+			So(metrics[1].Tags["error"], ShouldEqual, "")
+
+			Convey("and the tables are reloaded when the files change", func() {
+				So(ioutil.WriteFile(teams, []byte("host,team\nweb1,platform-team\n"), 0644), ShouldBeNil)
+				metrics, err := newPlugin.Process(mts, config)
+				So(err, ShouldBeNil)
+				So(metrics[0].Tags["owner_team"], ShouldEqual, "platform-team")
+			})
+		})
+
+		Convey("Bad tables and lookups are rejected", func() {
+			_, err := compileLookupTables(map[string]interface{}{"x": map[string]interface{}{}}, nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileLookupTables(map[string]interface{}{"x": map[string]interface{}{configLookupFile: filepath.Join(dir, "missing.csv")}}, nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileLookupTables(map[string]interface{}{"x": map[string]interface{}{configLookupFile: teams, configLookupMatch: "fuzzy"}}, nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileLookupTables(map[string]interface{}{"x": map[string]interface{}{configLookupFile: teams, configLookupMatch: lookupCIDR}}, nil)
+			So(err, ShouldNotBeNil)
+			for _, key := range []string{configLookupFormat, configLookupMatch} {
+				_, err = compileLookupTables(map[string]interface{}{"x": map[string]interface{}{configLookupFile: teams, key: []string{"csv"}}}, nil)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, key+" must be a string")
+			}
+			_, err = compileGateLookups([]interface{}{map[interface{}]interface{}{configLookupTable: "nope", configLookupKey: "host"}}, tables)
+			So(err, ShouldNotBeNil)
+			_, err = compileGateLookups([]interface{}{map[interface{}]interface{}{configLookupTable: "teams"}}, tables)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,335 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// How the parse phase treats repeated matches of a parse regex
+const (
+	// Only the first match of each regex is used
+	parseAllOff = ""
+	// Each match becomes its own metric, as if split
+	parseAllSplit = "split"
+	// Captures of the nth match get an _n suffix
+	parseAllIndex = "index"
+	// Captures of all matches are joined into one tag
+	parseAllJoin = "join"
+
+	defaultParseAllSeparator = ","
+)
+
+// How the parse regexes of a gate combine
+const (
+	// Every regex is applied, later matches override earlier ones
+	parseModeAllOverride = "all_override"
+	// Regexes are tried in order until one matches
+	parseModeFirstMatch = "first_match"
+	// Every regex is applied and must match
+	parseModeAllRequired = "all_required"
+)
+
+// What happens to a metric whose required parse regex didn't match
+const (
+	parseFailureDrop = "drop"
+	parseFailureTag  = "tag"
+
+	defaultParseFailureTag = "parse_failure"
+)
+
+// parseRule is a compiled parse regex and its options. Apart from
+// the regex, the options default to those set on the gate.
+type parseRule struct {
+	Regex    *regexp.Regexp
+	Required bool
+	// SkipEmpty drops captures that are empty strings
+	SkipEmpty bool
+	// Overwrite allows captures to replace tags the
+	// metric had before parsing
+	Overwrite bool
+	// Rename maps capture names to tag names
+	Rename map[string]string
+	// Prefix is prepended to every captured tag name
+	Prefix string
+}
+
+// tagName returns the tag a named capture is stored as
+func (r parseRule) tagName(name string) string {
+	if renamed, ok := r.Rename[name]; ok {
+		name = renamed
+	}
+	return r.Prefix + name
+}
+
+// keep reports whether a capture should be set as a tag, given the
+// tags the metric had before parsing
+func (r parseRule) keep(tag string, value string, existing map[string]string) bool {
+	if r.SkipEmpty && value == "" {
+		return false
+	}
+	if !r.Overwrite {
+		if _, ok := existing[tag]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r parseRule) String() string {
+	return r.Regex.String()
+}
+
+// parseMatch is one match of a parse regex in parse_all split mode
+type parseMatch struct {
+	Text   string
+	Fields map[string]string
+}
+
+func validateParseAll(mode string) error {
+	switch mode {
+	case parseAllOff, parseAllSplit, parseAllIndex, parseAllJoin:
+		return nil
+	}
+	return fmt.Errorf("%v must be one of %v, %v or %v, not %q", configParseAll, parseAllSplit, parseAllIndex, parseAllJoin, mode)
+}
+
+func validateParseMode(mode string) error {
+	switch mode {
+	case parseModeAllOverride, parseModeFirstMatch, parseModeAllRequired:
+		return nil
+	}
+	return fmt.Errorf("%v must be one of %v, %v or %v, not %q", configParseMode, parseModeAllOverride, parseModeFirstMatch, parseModeAllRequired, mode)
+}
+
+func validateParseFailure(action string) error {
+	switch action {
+	case parseFailureDrop, parseFailureTag:
+		return nil
+	}
+	return fmt.Errorf("%v must be one of %v or %v, not %q", configParseFailure, parseFailureDrop, parseFailureTag, action)
+}
+
+// compileParseRuleOptions reads the options shared by gates and
+// single parse rules into rule
+func compileParseRuleOptions(rawCfg map[interface{}]interface{}, rule *parseRule) error {
+	var ok bool
+	if iRequired, found := rawCfg[configParseRequired]; found {
+		rule.Required, ok = iRequired.(bool)
+		if !ok {
+			return fmt.Errorf("%v must be a bool, not a %T", configParseRequired, iRequired)
+		}
+	}
+	if iSkipEmpty, found := rawCfg[configSkipEmpty]; found {
+		rule.SkipEmpty, ok = iSkipEmpty.(bool)
+		if !ok {
+			return fmt.Errorf("%v must be a bool, not a %T", configSkipEmpty, iSkipEmpty)
+		}
+	}
+	if iOverwrite, found := rawCfg[configOverwrite]; found {
+		rule.Overwrite, ok = iOverwrite.(bool)
+		if !ok {
+			return fmt.Errorf("%v must be a bool, not a %T", configOverwrite, iOverwrite)
+		}
+	}
+	if iPrefix, found := rawCfg[configPrefix]; found {
+		rule.Prefix, ok = iPrefix.(string)
+		if !ok {
+			return fmt.Errorf("%v must be a string, not a %T", configPrefix, iPrefix)
+		}
+	}
+	if iRename, found := rawCfg[configRename]; found {
+		rawRename, ok := iRename.(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("%v must be a dict, not a %T", configRename, iRename)
+		}
+		rename := make(map[string]string, len(rule.Rename)+len(rawRename))
+		for from, to := range rule.Rename {
+			rename[from] = to
+		}
+		for iFrom, iTo := range rawRename {
+			from, ok := iFrom.(string)
+			if !ok {
+				return fmt.Errorf("%v key isn't a string, but a %T with value %v", configRename, iFrom, iFrom)
+			}
+			to, ok := iTo.(string)
+			if !ok || to == "" {
+				return fmt.Errorf("%v of %v must be a non-empty string", configRename, from)
+			}
+			rename[from] = to
+		}
+		rule.Rename = rename
+	}
+	return nil
+}
+
+// compileParseRules compiles the parse list, whose entries are
+// either regex strings or dicts with a regex and its options;
+// defaults holds the gate's options
+func compileParseRules(from []interface{}, defaults parseRule) ([]parseRule, error) {
+	var rules []parseRule
+	for _, iRule := range from {
+		rule := defaults
+		var expr string
+		switch v := iRule.(type) {
+		case string:
+			expr = v
+		case map[interface{}]interface{}:
+			var ok bool
+			expr, ok = v[configParseRegex].(string)
+			if !ok {
+				return nil, fmt.Errorf("Parse rule %v has no %v string", v, configParseRegex)
+			}
+			err := compileParseRuleOptions(v, &rule)
+			if err != nil {
+				return nil, fmt.Errorf("Parse rule %v: %v", expr, err)
+			}
+		default:
+			return nil, fmt.Errorf("Parse rule not a string or a dict but %T with value %v", iRule, iRule)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rule.Regex = regex
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// eachRuleMatch calls fn with the matches of each rule that applies
+// under the parse mode, in order; all is whether to find every match
+// of a rule or only the first. It fails if a required rule doesn't
+// match, after applying the rules that did.
+func eachRuleMatch(message string, rules []parseRule, mode string, all bool, fn func(rule parseRule, matches [][]string)) error {
+	var failed []string
+	matched := false
+	for _, rule := range rules {
+		if matched && mode == parseModeFirstMatch {
+			// The rule doesn't apply, but it still
+			// has to match if it's required
+			if rule.Required && !rule.Regex.MatchString(message) {
+				failed = append(failed, rule.Regex.String())
+			}
+			continue
+		}
+
+		var matches [][]string
+		if all {
+			matches = rule.Regex.FindAllStringSubmatch(message, -1)
+		} else if match := rule.Regex.FindStringSubmatch(message); match != nil {
+			matches = [][]string{match}
+		}
+		if matches == nil {
+			if rule.Required {
+				failed = append(failed, rule.Regex.String())
+			}
+			continue
+		}
+		matched = true
+		fn(rule, matches)
+	}
+	if failed != nil {
+		return fmt.Errorf("Required parse regexes didn't match: %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// parse returns the named captures of the first match of each rule,
+// given the tags the metric already has; the fields captured so far
+// are returned even if it fails
+func parse(message string, rules []parseRule, mode string, existing map[string]string) (map[string]string, error) {
+	var fields map[string]string
+	err := eachRuleMatch(message, rules, mode, false, func(rule parseRule, matches [][]string) {
+		for i, name := range rule.Regex.SubexpNames() {
+			if i == 0 || name == "" {
+				continue
+			}
+			tag := rule.tagName(name)
+			if !rule.keep(tag, matches[0][i], existing) {
+				continue
+			}
+			if fields == nil {
+				fields = make(map[string]string, 0)
+			}
+			fields[tag] = matches[0][i]
+		}
+	})
+	return fields, err
+}
+
+// parseAll gathers the captures of every match of each rule,
+// either indexing them by match or joining them with separator
+func parseAll(message string, rules []parseRule, mode string, allMode string, separator string, existing map[string]string) (map[string]string, error) {
+	var fields map[string]string
+	err := eachRuleMatch(message, rules, mode, true, func(rule parseRule, matches [][]string) {
+		joined := make(map[string][]string)
+		for idx, match := range matches {
+			for i, name := range rule.Regex.SubexpNames() {
+				if i == 0 || name == "" {
+					continue
+				}
+				tag := rule.tagName(name)
+				if allMode == parseAllIndex {
+					tag += "_" + strconv.Itoa(idx)
+				}
+				if !rule.keep(tag, match[i], existing) {
+					continue
+				}
+				if fields == nil {
+					fields = make(map[string]string, 0)
+				}
+				if allMode == parseAllIndex {
+					fields[tag] = match[i]
+				} else {
+					joined[tag] = append(joined[tag], match[i])
+				}
+			}
+		}
+		for tag, values := range joined {
+			fields[tag] = strings.Join(values, separator)
+		}
+	})
+	return fields, err
+}
+
+// parseEach returns every match of each rule, in rule order,
+// with the captures of that match alone
+func parseEach(message string, rules []parseRule, mode string, existing map[string]string) ([]parseMatch, error) {
+	var matches []parseMatch
+	err := eachRuleMatch(message, rules, mode, true, func(rule parseRule, ruleMatches [][]string) {
+		for _, match := range ruleMatches {
+			fields := make(map[string]string)
+			for i, name := range rule.Regex.SubexpNames() {
+				if i == 0 || name == "" {
+					continue
+				}
+				tag := rule.tagName(name)
+				if rule.keep(tag, match[i], existing) {
+					fields[tag] = match[i]
+				}
+			}
+			matches = append(matches, parseMatch{Text: match[0], Fields: fields})
+		}
+	})
+	return matches, err
+}
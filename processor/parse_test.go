@@ -0,0 +1,336 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const forwardedFor = `forwarded for 10.0.0.1, 10.0.0.2, 10.0.0.3`
+
+func TestParseAll(t *testing.T) {
+	Convey("Test parsing every match of a regex", t, func() {
+		rules := []parseRule{{Regex: regexp.MustCompile(`(?P<ip>\d+\.\d+\.\d+\.\d+)`)}}
+
+		Convey("Only the first match is used by default", func() {
+			fields, err := parse(forwardedFor, rules, parseModeAllOverride, nil)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{"ip": "10.0.0.1"})
+		})
+
+		Convey("Index mode suffixes captures with the match number", func() {
+			fields, err := parseAll(forwardedFor, rules, parseModeAllOverride, parseAllIndex, defaultParseAllSeparator, nil)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{
+				"ip_0": "10.0.0.1",
+				"ip_1": "10.0.0.2",
+				"ip_2": "10.0.0.3",
+			})
+		})
+
+		Convey("Join mode joins captures with the separator", func() {
+			fields, err := parseAll(forwardedFor, rules, parseModeAllOverride, parseAllJoin, ";", nil)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{"ip": "10.0.0.1;10.0.0.2;10.0.0.3"})
+		})
+
+		Convey("Each mode returns every match separately", func() {
+			matches, err := parseEach(forwardedFor, rules, parseModeAllOverride, nil)
+			So(err, ShouldBeNil)
+			So(len(matches), ShouldEqual, 3)
+			So(matches[1].Text, ShouldEqual, "10.0.0.2")
+			So(matches[1].Fields, ShouldResemble, map[string]string{"ip": "10.0.0.2"})
+		})
+
+		Convey("Unnamed groups don't become tags", func() {
+			fields, err := parse("a b", []parseRule{{Regex: regexp.MustCompile(`(a) (?P<b>b)`)}}, parseModeAllOverride, nil)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{"b": "b"})
+		})
+	})
+
+	Convey("Test processing with parse_all split", t, func() {
+		var matchMap map[string]interface{} = make(map[string]interface{})
+		matchMap[configParseRegexp] = []string{`(?P<ip>\d+\.\d+\.\d+\.\d+)`}
+		matchMap[configParseAll] = parseAllSplit
+		matchMap[configAddTags] = map[string]string{"client": "{{ .Tags.ip }}"}
+		mmYaml, err := yaml.Marshal(matchMap)
+		So(err, ShouldBeNil)
+		config := plugin.Config{"^forwarded for": string(mmYaml)}
+
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"hello": "world"},
+				Data:      forwardedFor,
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"hello": "world"},
+				Data:      "forwarded for nobody",
+			},
+		}
+
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 4)
+		for idx, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+			So(metrics[idx].Data, ShouldEqual, ip)
+			So(metrics[idx].Tags["hello"], ShouldEqual, "world")
+			So(metrics[idx].Tags["client"], ShouldEqual, ip)
+		}
+		Convey("A metric without matches is passed on whole", func() {
+			So(metrics[3].Data, ShouldEqual, "forwarded for nobody")
+			So(metrics[3].Tags, ShouldNotContainKey, "ip")
+		})
+
+		Convey("A bad mode is a config error", func() {
+			config["^forwarded for"] = "parse_all: bogus\nparse:\n  - '.*'\n"
+			_, err := New().Process(mts, config)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseModes(t *testing.T) {
+	Convey("Test how parse regexes combine", t, func() {
+		raw := []interface{}{
+			`instanceHostname": "(?P<hostname>[^"]*)"`,
+			`otherHostname": "(?P<hostname>[^"]+)"`,
+		}
+		message := `{"instanceHostname": "myhost1", "otherHostname": "differenthost"}`
+
+		Convey("By default later matches override earlier ones", func() {
+			rules, err := compileParseRules(raw, parseRule{Overwrite: true})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeAllOverride, nil)
+			So(err, ShouldBeNil)
+			So(fields["hostname"], ShouldEqual, "differenthost")
+		})
+
+		Convey("First match stops at the first regex that matches", func() {
+			rules, err := compileParseRules(raw, parseRule{Overwrite: true})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeFirstMatch, nil)
+			So(err, ShouldBeNil)
+			So(fields["hostname"], ShouldEqual, "myhost1")
+
+			fields, err = parse(`{"otherHostname": "differenthost"}`, rules, parseModeFirstMatch, nil)
+			So(err, ShouldBeNil)
+			So(fields["hostname"], ShouldEqual, "differenthost")
+		})
+
+		Convey("All required fails if any regex doesn't match", func() {
+			rules, err := compileParseRules(raw, parseRule{Required: true, Overwrite: true})
+			So(err, ShouldBeNil)
+			_, err = parse(message, rules, parseModeAllRequired, nil)
+			So(err, ShouldBeNil)
+			fields, err := parse(`{"instanceHostname": "myhost1"}`, rules, parseModeAllRequired, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "otherHostname")
+			So(fields["hostname"], ShouldEqual, "myhost1")
+		})
+
+		Convey("Single regexes can be required", func() {
+			rules, err := compileParseRules([]interface{}{
+				raw[0],
+				map[interface{}]interface{}{configParseRegex: raw[1], configParseRequired: true},
+			}, parseRule{Overwrite: true})
+			So(err, ShouldBeNil)
+			So(rules[0].Required, ShouldBeFalse)
+			So(rules[1].Required, ShouldBeTrue)
+
+			Convey("and must match even when first match skips them", func() {
+				_, err = parse(`{"instanceHostname": "myhost1"}`, rules, parseModeFirstMatch, nil)
+				So(err, ShouldNotBeNil)
+				_, err = parse(message, rules, parseModeFirstMatch, nil)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("Bad rules are rejected", func() {
+			_, err := compileParseRules([]interface{}{123}, parseRule{Overwrite: true})
+			So(err, ShouldNotBeNil)
+			_, err = compileParseRules([]interface{}{map[interface{}]interface{}{configParseRequired: true}}, parseRule{Overwrite: true})
+			So(err, ShouldNotBeNil)
+			_, err = compileParseRules([]interface{}{map[interface{}]interface{}{configParseRegex: ".*", configParseRequired: "yes"}}, parseRule{Overwrite: true})
+			So(err, ShouldNotBeNil)
+			So(validateParseMode("bogus"), ShouldNotBeNil)
+			So(validateParseFailure("bogus"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test processing metrics missing a required field", t, func() {
+		gateCfg := `
+parse:
+  - '^(?P<method>GET|POST) '
+  - regex: ' (?P<status>[0-9]{3})$'
+    required: true
+`
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "GET /index.html 200",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "GET /index.html -",
+			},
+		}
+
+		Convey("They are dropped by default", func() {
+			metrics, err := New().Process(mts, plugin.Config{"^(GET|POST)": gateCfg})
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].Tags["status"], ShouldEqual, "200")
+		})
+
+		Convey("They can be tagged as parse failures instead", func() {
+			gateCfg += "parse_failure: tag\nparse_failure_tag: failed\n"
+			metrics, err := New().Process(mts, plugin.Config{"^(GET|POST)": gateCfg})
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 2)
+			So(metrics[0].Tags, ShouldNotContainKey, "failed")
+			So(metrics[1].Tags["method"], ShouldEqual, "GET")
+			So(metrics[1].Tags["failed"], ShouldContainSubstring, "status")
+		})
+	})
+}
+
+func TestParseCaptureOptions(t *testing.T) {
+	Convey("Test options controlling how captures become tags", t, func() {
+		message := `host=web1 user= status=200`
+		raw := []interface{}{`host=(?P<host>\S*) user=(?P<user>\S*) status=(?P<status>\S*)`}
+		existing := map[string]string{"host": "collector-host"}
+
+		Convey("By default empty captures and existing tags are overwritten", func() {
+			rules, err := compileParseRules(raw, parseRule{Overwrite: true})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeAllOverride, existing)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{"host": "web1", "user": "", "status": "200"})
+		})
+
+		Convey("Unnamed groups set no tags", func() {
+			rules, err := compileParseRules([]interface{}{`(GET|POST) (?P<path>\S+)`, `status=(\S+)`}, parseRule{Overwrite: true})
+			So(err, ShouldBeNil)
+			for _, mode := range []string{parseAllOff, parseAllIndex, parseAllJoin} {
+				var fields map[string]string
+				if mode == parseAllOff {
+					fields, err = parse("GET /a status=200", rules, parseModeAllOverride, nil)
+				} else {
+					fields, err = parseAll("GET /a status=200", rules, parseModeAllOverride, mode, ",", nil)
+				}
+				So(err, ShouldBeNil)
+				So(fields, ShouldNotContainKey, "")
+			}
+			matches, err := parseEach("GET /a status=200", rules, parseModeAllOverride, nil)
+			So(err, ShouldBeNil)
+			So(matches[0].Fields, ShouldResemble, map[string]string{"path": "/a"})
+			So(matches[1].Fields, ShouldBeEmpty)
+		})
+
+		Convey("Empty captures can be skipped", func() {
+			rules, err := compileParseRules(raw, parseRule{Overwrite: true, SkipEmpty: true})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeAllOverride, existing)
+			So(err, ShouldBeNil)
+			So(fields, ShouldNotContainKey, "user")
+		})
+
+		Convey("Existing tags can be left alone", func() {
+			rules, err := compileParseRules(raw, parseRule{})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeAllOverride, existing)
+			So(err, ShouldBeNil)
+			So(fields, ShouldNotContainKey, "host")
+			So(fields["status"], ShouldEqual, "200")
+		})
+
+		Convey("Captures can be renamed and prefixed", func() {
+			rules, err := compileParseRules([]interface{}{
+				map[interface{}]interface{}{
+					configParseRegex: raw[0],
+					configRename:     map[interface{}]interface{}{"status": "code"},
+					configPrefix:     "nginx.",
+				},
+			}, parseRule{Overwrite: true, Rename: map[string]string{"user": "remote_user"}})
+			So(err, ShouldBeNil)
+			fields, err := parse(message, rules, parseModeAllOverride, existing)
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, map[string]string{
+				"nginx.host":        "web1",
+				"nginx.remote_user": "",
+				"nginx.code":        "200",
+			})
+		})
+	})
+
+	Convey("Test capture options set on a gate", t, func() {
+		gateCfg := `
+parse:
+  - 'host=(?P<host>\S*) user=(?P<user>\S*)'
+skip_empty: true
+overwrite: false
+prefix: "app."
+rename:
+  user: login
+`
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"app.host": "collector-host"},
+				Data:      "host=web1 user=",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "host=web2 user=bob",
+			},
+		}
+		metrics, err := New().Process(mts, plugin.Config{"^host=": gateCfg})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[0].Tags, ShouldResemble, map[string]string{"app.host": "collector-host"})
+		So(metrics[1].Tags, ShouldResemble, map[string]string{"app.host": "web2", "app.login": "bob"})
+
+		Convey("Bad options are config errors", func() {
+			_, err := New().Process(mts, plugin.Config{"^host=": "parse: ['.*']\nskip_empty: sometimes\n"})
+			So(err, ShouldNotBeNil)
+			_, err = New().Process(mts, plugin.Config{"^host=": "parse: ['.*']\nrename: [a, b]\n"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -23,10 +23,10 @@ import (
 	"fmt"
 	"regexp"
 	"text/template"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
-	yaml "gopkg.in/yaml.v2"
 )
 
 const (
@@ -38,20 +38,104 @@ const (
 	configSplitRegexp = "split"
 	configParseRegexp = "parse"
 	configAddTags     = "tags"
+	configNamespace   = "namespace"
+	configMatchTags   = "match_tags"
+	configParseAll    = "parse_all"
+	configParseAllSep = "parse_all_separator"
+
+	configParseMode       = "parse_mode"
+	configParseFailure    = "parse_failure"
+	configParseFailureTag = "parse_failure_tag"
+	configParseRegex      = "regex"
+	configParseRequired   = "required"
+	configSkipEmpty       = "skip_empty"
+	configOverwrite       = "overwrite"
+	configPrefix          = "prefix"
+	configRename          = "rename"
+	configRemoveTags      = "remove_tags"
+	configRenameTags      = "rename_tags"
+	configKeepTags        = "keep_tags"
+	configLookup          = "lookup"
+	configIPEnrich        = "ip_enrich"
+	configUserAgent       = "useragent"
+	configURL             = "url"
+	configEmitCounters    = "emit_counters"
+	configAggregate       = "aggregate"
+	configDedup           = "dedup"
+	configSampleRate      = "sample_rate"
+	configRateLimit       = "rate_limit"
 )
 
 type Plugin struct {
+	// files are the lookup tables and other local
+	// files the config refers to
+	files *fileCache
+	// cardinality tracks the values of the tags
+	// with a cardinality limit
+	cardinality *cardinalityTracker
+	// aggregates hold the gates' aggregates
+	// until their interval ends
+	aggregates *aggregator
+	// dedup holds back repeated metrics
+	// until their window closes
+	dedup *deduplicator
+	// throttles hold the gates' rate limits
+	throttles *throttler
+	// stats add up what the gates did
+	stats *processorStats
 }
 
+// internalConfig is the compiled form of a gate
 type internalConfig struct {
-	Parse    []*regexp.Regexp
-	Split    []*regexp.Regexp
-	Template *template.Template
+	Name       string
+	Match      *regexp.Regexp
+	Namespaces []namespaceSelector
+	Tags       tagSelectors
+	Parse      []parseRule
+	Split      []*regexp.Regexp
+	Template   *template.Template
+
+	ParseAll          string
+	ParseAllSeparator string
+	ParseMode         string
+	ParseFailure      string
+	ParseFailureTag   string
+	OnError           string
+	ErrorTag          string
+	DeadLetterSuffix  []string
+
+	Lookups   []gateLookup
+	IPEnrich  []gateIPEnrich
+	UserAgent []gateUserAgent
+	URLs      []gateURL
+	TagEdits  *tagEdits
+
+	Counters  *gateCounters
+	Aggregate *gateAggregate
+	Dedup     *gateDedup
+	Sampling  *gateSampling
+	RateLimit *gateRateLimit
+
+	// Tests are the test cases declared alongside the gate
+	Tests []ruleTest
+}
+
+// rewritesTags reports whether the gate sets or edits tags
+// beyond the ones it parses
+func (c internalConfig) rewritesTags() bool {
+	return c.Template != nil || c.TagEdits != nil || c.Lookups != nil || c.IPEnrich != nil || c.UserAgent != nil || c.URLs != nil
 }
 
 // New() returns a new instance of the plugin
 func New() *Plugin {
-	p := &Plugin{}
+	p := &Plugin{
+		files:       newFileCache(),
+		cardinality: newCardinalityTracker(),
+		aggregates:  newAggregator(),
+		dedup:       newDeduplicator(),
+		throttles:   newThrottler(),
+		stats:       newProcessorStats(),
+	}
 	return p
 }
 
@@ -64,99 +148,120 @@ func (p *Plugin) GetConfigPolicy() (plugin.ConfigPolicy, error) {
 // Process processes the data
 func (p *Plugin) Process(metrics []plugin.Metric, cfg plugin.Config) ([]plugin.Metric, error) {
 	// Configuration
-	var err error
-	var tagsTemplates *template.Template
-	var internalCfg map[*regexp.Regexp]internalConfig = make(map[*regexp.Regexp]internalConfig)
-	var splitRegexes, parseRegexes []*regexp.Regexp
-	var mapRegex *regexp.Regexp
-	var singletonList []plugin.Metric
-	var didMatch bool
-	var parsedMetrics, newMetrics []plugin.Metric
-	var rawRegexCfg map[string]interface{} = make(map[string]interface{})
-
-	for rawRegex, interfaceRegexCfg := range cfg {
-		mapRegex, err = regexp.Compile(rawRegex)
-		if err != nil {
-			return nil, err
-		}
-
-		rawStringRegexCfg, ok := interfaceRegexCfg.(string)
-		if ok {
-			err = yaml.Unmarshal([]byte(rawStringRegexCfg), rawRegexCfg)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		splitRegexesRaw, ok := rawRegexCfg[configSplitRegexp].([]interface{})
-		if ok {
-			splitRegexes, err = compileRegexes(splitRegexesRaw)
-			if err != nil {
-				return nil, fmt.Errorf("Couldn't compile split regexes: %v", splitRegexesRaw)
-			}
-		}
-
-		parseRegexesRaw, ok := rawRegexCfg[configParseRegexp].([]interface{})
-		if !ok {
-			return nil, fmt.Errorf("Must specify parse regexps at least")
-		}
-		parseRegexes, err = compileRegexes(parseRegexesRaw)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to compile a regex: %v", err)
-		}
-
-		tagTemplatesRaw, ok := rawRegexCfg[configAddTags].(map[interface{}]interface{})
-		if ok {
-			tagsTemplates, err = compileTemplates(tagTemplatesRaw)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		internalCfg[mapRegex] = internalConfig{
-			Parse:    parseRegexes,
-			Split:    splitRegexes,
-			Template: tagsTemplates,
-		}
+	pluginCfg, err := parseConfig(cfg, p.files)
+	if err != nil {
+		return nil, err
 	}
+	return p.process(metrics, pluginCfg)
+}
 
-	if len(internalCfg) < 1 {
-		return nil, fmt.Errorf("At least one match->parse block must be specified")
-	}
+// process processes the data with the compiled config
+func (p *Plugin) process(metrics []plugin.Metric, pluginCfg *pluginConfig) ([]plugin.Metric, error) {
+	var singletonList []plugin.Metric
+	var didMatch bool
+	var parsedMetrics, failedMetrics, newMetrics []plugin.Metric
+	var err error
 
 	newMetrics = make([]plugin.Metric, 0)
+	counters := newCounterBatch()
+	batchStats := make(map[string]*gateStats)
+	now := time.Now()
 
 MetricIter:
 	for _, m := range metrics {
 		didMatch = false
-		for mustMatch, matchConfig := range internalCfg {
-			testStr, ok := m.Data.(string)
-			if !ok {
+		testStr, coerced := coerceData(m.Data, pluginCfg.CoerceData)
+		trace := pluginCfg.Debug.start(m, testStr)
+		for _, gate := range pluginCfg.Gates {
+			// Cheap namespace and tag selectors go first
+			// so unselected metrics skip the regexes
+			if !gate.selects(m) {
+				trace.log(traceStageGate, log.Fields{"gate": gate.Name, "selected": false})
+				continue
+			}
+			if !coerced {
+				if pluginCfg.CoerceData != coerceDrop {
+					// Passed down the chain as-is below
+					continue
+				}
 				warnFields := map[string]interface{}{
 					"namespace": m.Namespace.Strings(),
 					"data":      m.Data,
+					"gate":      gate.Name,
 				}
 				log.WithFields(warnFields).Warn("Match Phase: unexpected data type, plugin processes only strings")
 				continue MetricIter
 			}
-			if mustMatch.FindStringSubmatch(testStr) != nil {
+			stats, ok := batchStats[gate.Name]
+			if !ok {
+				stats = &gateStats{}
+				batchStats[gate.Name] = stats
+			}
+			stats.In++
+			gateStart := time.Now()
+			if gate.Match.FindStringSubmatch(testStr) == nil {
+				stats.ProcessingTime += time.Since(gateStart)
+				trace.log(traceStageGate, log.Fields{"gate": gate.Name, "selected": true, "matched": false})
+			} else {
+				trace.log(traceStageGate, log.Fields{"gate": gate.Name, "selected": true, "matched": true})
+				stats.Matched++
 				didMatch = true
-				if matchConfig.Split != nil {
-					splitMetrics, err := splitMetric(m, matchConfig.Split)
+				coercedMetric := m
+				coercedMetric.Data = testStr
+				if gate.Split != nil {
+					splitMetrics, err := splitMetric(coercedMetric, gate.Split)
 					if err == nil {
-						parsedMetrics, err = processMetrics(splitMetrics, matchConfig.Parse, mustMatch, matchConfig.Template)
+						stats.Split += uint64(len(splitMetrics))
+						if trace != nil {
+							var pieces []interface{}
+							for _, split := range splitMetrics {
+								pieces = append(pieces, split.Data)
+							}
+							trace.log(traceStageSplit, log.Fields{"gate": gate.Name, "pieces": pieces})
+						}
+						parsedMetrics, failedMetrics, err = processMetrics(splitMetrics, gate, pluginCfg.GateTag, stats, trace)
 						if err != nil {
+							p.stats.add(pluginCfg.ID, batchStats)
 							return nil, err
 						}
 					}
 				} else {
-					singletonList = make([]plugin.Metric, 1)
-					singletonList = append(singletonList, m)
-					parsedMetrics, err = processMetrics(singletonList, matchConfig.Parse, mustMatch, matchConfig.Template)
+					singletonList = []plugin.Metric{coercedMetric}
+					parsedMetrics, failedMetrics, err = processMetrics(singletonList, gate, pluginCfg.GateTag, stats, trace)
 					if err != nil {
+						p.stats.add(pluginCfg.ID, batchStats)
 						return nil, err
 					}
 				}
+				stats.ProcessingTime += time.Since(gateStart)
+				// Metrics that failed go out as the error policy
+				// left them, not counted, aggregated or held back
+				newMetrics = append(newMetrics, failedMetrics...)
+				if gate.Counters != nil {
+					for _, parsed := range parsedMetrics {
+						counters.add(gate, parsed)
+					}
+					if gate.Counters.Replace {
+						continue
+					}
+				}
+				if gate.Aggregate != nil {
+					for _, parsed := range parsedMetrics {
+						p.aggregates.add(pluginCfg.ID, gate, parsed, now)
+					}
+					if gate.Aggregate.Replace {
+						continue
+					}
+				}
+				if gate.Sampling != nil || gate.RateLimit != nil {
+					parsedMetrics = p.throttles.throttle(pluginCfg.ID, gate, parsedMetrics, now)
+				}
+				if gate.Dedup != nil {
+					for _, parsed := range parsedMetrics {
+						newMetrics = append(newMetrics, p.dedup.add(pluginCfg.ID, gate, parsed, now)...)
+					}
+					continue
+				}
 				newMetrics = append(newMetrics, parsedMetrics...)
 			}
 		}
@@ -164,27 +269,59 @@ MetricIter:
 		// If we matched, we parsed
 		// If we did not match, emit the "original"
 		if !didMatch {
+			trace.log(traceStagePassed, nil)
 			newMetrics = append(newMetrics, m)
 		}
 	}
 
+	newMetrics = append(newMetrics, p.dedup.flush(pluginCfg.ID, now)...)
+	newMetrics = append(newMetrics, counters.metrics(now)...)
+	newMetrics = append(newMetrics, p.aggregates.flush(pluginCfg.ID, now)...)
+	p.release(newMetrics, pluginCfg, now)
+
+	p.stats.add(pluginCfg.ID, batchStats)
+	if pluginCfg.SelfMetrics != nil {
+		selfMetrics := p.stats.metrics(pluginCfg.ID, pluginCfg.SelfMetrics, p.throttles.drops(pluginCfg.ID), p.cardinality.overflows(pluginCfg.ID), now)
+		newMetrics = append(newMetrics, selfMetrics...)
+	}
+
 	return newMetrics, nil
 }
 
-func parse(message string, regexes []*regexp.Regexp) (map[string]string, error) {
-	var fields map[string]string
-	for _, regex := range regexes {
-		match := regex.FindStringSubmatch(message)
-		for i, name := range regex.SubexpNames() {
-			if i > 0 && i <= len(match) {
-				if fields == nil {
-					fields = make(map[string]string, 0)
-				}
-				fields[name] = match[i]
-			}
+// Flush returns the metrics held back for the config, the repeats
+// and aggregates, without waiting for their windows to end. It's for
+// when no more metrics are coming, as at the end of a file.
+func (p *Plugin) Flush(cfg plugin.Config) ([]plugin.Metric, error) {
+	pluginCfg, err := parseConfig(cfg, p.files)
+	if err != nil {
+		return nil, err
+	}
+	return p.flush(pluginCfg), nil
+}
+
+// flush returns the metrics held back for the compiled config
+func (p *Plugin) flush(pluginCfg *pluginConfig) []plugin.Metric {
+	newMetrics := make([]plugin.Metric, 0)
+	newMetrics = append(newMetrics, p.dedup.drain(pluginCfg.ID)...)
+	newMetrics = append(newMetrics, p.aggregates.drain(pluginCfg.ID)...)
+	p.release(newMetrics, pluginCfg, time.Now())
+	return newMetrics
+}
+
+// release redacts the metrics about to leave the plugin and
+// holds their tags within the cardinality limits, in place
+func (p *Plugin) release(metrics []plugin.Metric, pluginCfg *pluginConfig, now time.Time) {
+	// Nothing sensitive leaves, whether we
+	// processed it or passed it through
+	if pluginCfg.Redactor != nil {
+		for idx := range metrics {
+			metrics[idx] = pluginCfg.Redactor.redact(metrics[idx])
 		}
 	}
-	return fields, nil
+
+	if pluginCfg.Cardinality != nil {
+		p.cardinality.guard(pluginCfg.ID, metrics, pluginCfg.Cardinality, now)
+	}
 }
 
 func compileRegexes(from []interface{}) ([]*regexp.Regexp, error) {
@@ -203,8 +340,8 @@ func compileRegexes(from []interface{}) ([]*regexp.Regexp, error) {
 	return regexes, nil
 }
 
-func compileTemplates(templates map[interface{}]interface{}) (*template.Template, error) {
-	rootTemplate := template.New("")
+func compileTemplates(templates map[interface{}]interface{}, funcs template.FuncMap) (*template.Template, error) {
+	rootTemplate := template.New("").Funcs(funcs)
 	for iTag, iTagTemplate := range templates {
 		tag, ok := iTag.(string)
 		if !ok {
@@ -270,72 +407,201 @@ func splitMetric(metric plugin.Metric, regexes []*regexp.Regexp) ([]plugin.Metri
 	return metrics, nil
 }
 
-func processMetrics(metrics []plugin.Metric, regexps []*regexp.Regexp, mustMatch *regexp.Regexp, tagsTemplates *template.Template) ([]plugin.Metric, error) {
-	var newMetrics []plugin.Metric
+// processMetrics parses and tags the metrics a gate matched,
+// returning those processed apart from those that failed
+func processMetrics(metrics []plugin.Metric, gate internalConfig, gateTag string, stats *gateStats, trace *metricTrace) ([]plugin.Metric, []plugin.Metric, error) {
+	var newMetrics, failedMetrics []plugin.Metric
 	for _, n := range metrics {
 		logBlock, ok := n.Data.(string)
 		if !ok {
 			warnFields := map[string]interface{}{
 				"namespace": n.Namespace.Strings(),
 				"data":      n.Data,
+				"gate":      gate.Name,
 			}
 			log.WithFields(warnFields).Warn("unexpected data type, plugin processes only strings")
 			continue
 		}
-		if mustMatch.FindStringSubmatch(logBlock) == nil {
+		if gate.Match.FindStringSubmatch(logBlock) == nil {
+			trace.log(traceStageMatchAgain, log.Fields{"gate": gate.Name, "piece": logBlock, "matched": false})
+			stats.MatchAgainDropped++
 			continue
 		}
+		trace.log(traceStageMatchAgain, log.Fields{"gate": gate.Name, "piece": logBlock, "matched": true})
+		trace.parseRules(gate, logBlock)
+
+		var parseErr error
+		var matches []parseMatch
+		if gate.ParseAll == parseAllSplit {
+			matches, parseErr = parseEach(logBlock, gate.Parse, gate.ParseMode, n.Tags)
+		} else {
+			var newTags map[string]string
+			if gate.ParseAll == parseAllOff {
+				newTags, parseErr = parse(logBlock, gate.Parse, gate.ParseMode, n.Tags)
+			} else {
+				newTags, parseErr = parseAll(logBlock, gate.Parse, gate.ParseMode, gate.ParseAll, gate.ParseAllSeparator, n.Tags)
+			}
+			matches = []parseMatch{{Text: logBlock, Fields: newTags}}
+		}
+		if len(matches) == 0 {
+			// Nothing to split on, so just
+			// like a parse without a match
+			matches = []parseMatch{{Text: logBlock}}
+		}
+		if trace != nil {
+			for _, match := range matches {
+				fields := log.Fields{"gate": gate.Name, "piece": match.Text, "tags": match.Fields}
+				if parseErr != nil {
+					fields["error"] = parseErr.Error()
+				}
+				trace.log(traceStageParse, fields)
+			}
+		}
 
-		newTags, err := parse(logBlock, regexps)
-		if err != nil {
+		if parseErr != nil {
 			warnFields := map[string]interface{}{
 				"namespace":       n.Namespace.Strings(),
 				"data":            n.Data,
-				configParseRegexp: regexps,
+				"gate":            gate.Name,
+				configParseRegexp: gate.Parse,
 			}
-			log.WithFields(warnFields).Warn(err)
-			continue
-		}
-
-		if newTags != nil || tagsTemplates != nil {
-			// Because we've split the metric,
-			// there's a chance we're using the
-			// same tags pointer. So if we need
-			// to merge from this one split, we
-			// need to create a whole new tags
-			// map.
-			oldTags := n.Tags
-			n.Tags = make(map[string]string)
-
-			for nf_key, nf_value := range oldTags {
-				n.Tags[nf_key] = nf_value
+			log.WithFields(warnFields).Warn(parseErr)
+			stats.ParseFailures++
+
+			policy, tag := gate.errorPolicy(stageParse)
+			trace.log(traceStageError, log.Fields{"gate": gate.Name, "failed_stage": stageParse, "policy": policy, "error": parseErr.Error()})
+			switch policy {
+			case errorFailBatch:
+				return nil, nil, stageError{Gate: gate.Name, Stage: stageParse, Err: parseErr}
+			case errorDropMetric:
+				continue
+			case errorPassOriginal:
+				failedMetrics = append(failedMetrics, n)
+				continue
+			case errorDeadLetter:
+				stats.DeadLettered++
+				failedMetrics = append(failedMetrics, gate.deadLetter(n, stageParse, parseErr))
+				continue
 			}
-
-			for nf_key, nf_value := range newTags {
-				n.Tags[nf_key] = nf_value
+			for idx := range matches {
+				matches[idx].Fields = tagError(matches[idx].Fields, tag, parseErr)
 			}
-
 		}
 
-		// Tags templating here
-		if tagsTemplates != nil {
-			newTags, err := executeTemplates(n, tagsTemplates)
+		for _, match := range matches {
+			piece := n
+			piece.Data = match.Text
+			tagged, err := tagMetric(piece, match.Fields, gate, gateTag, stats, trace)
+			// Only a tag_error parse policy gets here with parseErr
+			failed := parseErr != nil
 			if err != nil {
-				warnFields := map[string]interface{}{
-					"namespace": n.Namespace.Strings(),
-					"data":      n.Data,
-					"template":  tagsTemplates.DefinedTemplates(),
+				policy, tag := gate.errorPolicy(stageTemplate)
+				trace.log(traceStageError, log.Fields{"gate": gate.Name, "failed_stage": stageTemplate, "policy": policy, "error": err.Error()})
+				switch policy {
+				case errorFailBatch:
+					return nil, nil, stageError{Gate: gate.Name, Stage: stageTemplate, Err: err}
+				case errorDropMetric:
+					continue
+				case errorPassOriginal:
+					tagged = piece
+					failed = true
+				case errorTagError:
+					tagged.Tags = tagError(tagged.Tags, tag, err)
+					failed = true
+				case errorDeadLetter:
+					stats.DeadLettered++
+					tagged = gate.deadLetter(piece, stageTemplate, err)
+					failed = true
 				}
-				log.WithFields(warnFields).Warn(err)
+			}
+			trace.log(traceStageOutput, log.Fields{"gate": gate.Name, "output_namespace": tagged.Namespace.Strings(), "output_data": tagged.Data, "tags": tagged.Tags})
+			if failed {
+				failedMetrics = append(failedMetrics, tagged)
 				continue
 			}
-			for nf_key, nf_value := range newTags {
-				n.Tags[nf_key] = nf_value
+			newMetrics = append(newMetrics, tagged)
+		}
+	}
+	return newMetrics, failedMetrics, nil
+}
+
+// tagError records an error in tag, in a copy of tags
+func tagError(tags map[string]string, tag string, err error) map[string]string {
+	tagged := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	tagged[tag] = err.Error()
+	return tagged
+}
+
+// tagMetric merges the parsed tags into the metric and runs the
+// gate's templates over it; if a template fails, it returns the
+// metric as it was before the templates, and the error
+func tagMetric(n plugin.Metric, newTags map[string]string, gate internalConfig, gateTag string, stats *gateStats, trace *metricTrace) (plugin.Metric, error) {
+	if newTags != nil || gateTag != "" || gate.rewritesTags() {
+		// Because we've split the metric,
+		// there's a chance we're using the
+		// same tags pointer. So if we need
+		// to merge from this one split, we
+		// need to create a whole new tags
+		// map.
+		oldTags := n.Tags
+		n.Tags = make(map[string]string)
+
+		for nf_key, nf_value := range oldTags {
+			n.Tags[nf_key] = nf_value
+		}
+
+		for nf_key, nf_value := range newTags {
+			n.Tags[nf_key] = nf_value
+		}
+
+		if gateTag != "" {
+			n.Tags[gateTag] = gate.Name
+		}
+
+		for _, lookup := range gate.Lookups {
+			lookup.apply(n.Tags)
+		}
+
+		for _, ipEnrich := range gate.IPEnrich {
+			ipEnrich.apply(n.Tags)
+		}
+
+		for _, userAgent := range gate.UserAgent {
+			userAgent.apply(n.Tags)
+		}
+
+		for _, url := range gate.URLs {
+			url.apply(n.Tags)
+		}
+	}
+
+	// Tags templating here
+	if gate.Template != nil {
+		newTags, err := executeTemplates(n, gate.Template)
+		if err != nil {
+			warnFields := map[string]interface{}{
+				"namespace": n.Namespace.Strings(),
+				"data":      n.Data,
+				"gate":      gate.Name,
+				"template":  gate.Template.DefinedTemplates(),
 			}
+			log.WithFields(warnFields).Warn(err)
+			stats.TemplateErrors++
+			return n, err
+		}
+		trace.log(traceStageTemplate, log.Fields{"gate": gate.Name, "piece": n.Data, "output": newTags})
+		for nf_key, nf_value := range newTags {
+			n.Tags[nf_key] = nf_value
 		}
-		newMetrics = append(newMetrics, n)
 	}
-	return newMetrics, nil
+
+	if gate.TagEdits != nil {
+		gate.TagEdits.apply(n.Tags)
+	}
+	return n, nil
 }
 
 func executeTemplates(metric plugin.Metric, template *template.Template) (map[string]string, error) {
@@ -315,4 +315,52 @@ func TestProcess(t *testing.T) {
 			So(len(metrics), ShouldEqual, 0)
 		})
 	})
+
+	Convey("Test flushing metrics held back", t, func() {
+		config := plugin.Config{
+			configGateTag: "gate",
+			configGates: `
+- name: links
+  match: "^link"
+  parse: ['^link (?P<state>\S+)']
+  dedup: {window: 1h}
+- name: took
+  match: "took"
+  parse: ['took (?P<ms>[0-9]+)ms']
+  aggregate: {value: ms, stats: [sum], interval: 1h}
+`,
+		}
+		var mts []plugin.Metric
+		for _, line := range []string{"link down", "link down", "took 5ms", "took 7ms"} {
+			mts = append(mts, plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      line,
+			})
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldBeEmpty)
+
+		metrics, err = newPlugin.Flush(plugin.Config{configGates: `[{name: links, match: "^link", parse: ['x']}]`})
+		So(err, ShouldBeNil)
+		So(metrics, ShouldBeEmpty)
+
+		metrics, err = newPlugin.Flush(config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[0].Tags["state"], ShouldEqual, "down")
+		So(metrics[0].Tags[defaultDedupTag], ShouldEqual, "2")
+		So(metrics[1].Namespace.Strings(), ShouldResemble, []string{Name, configAggregate, "ms", aggregateSum})
+		So(metrics[1].Data, ShouldEqual, 12.0)
+
+		metrics, err = newPlugin.Flush(config)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldBeEmpty)
+
+		_, err = newPlugin.Flush(plugin.Config{"(": `{parse: []}`})
+		So(err, ShouldNotBeNil)
+	})
 }
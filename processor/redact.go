@@ -0,0 +1,258 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configRedactDetectors = "detectors"
+	configRedactPatterns  = "patterns"
+	configRedactMask      = "mask"
+	configRedactHashKey   = "hash_key"
+	configRedactTags      = "tags"
+
+	defaultRedactMask = "[REDACTED]"
+
+	// Only this capture group of a pattern is
+	// redacted, if the pattern has one
+	redactSecretGroup = "secret"
+
+	// Length of the hex-encoded keyed hashes
+	redactHashLength = 16
+)
+
+// redactPattern finds one kind of sensitive data; valid, if set,
+// weeds out matches that only look like it
+type redactPattern struct {
+	Regex *regexp.Regexp
+	Valid func(string) bool
+	// Trim, if set, is trimmed from the end of matches
+	// that aren't valid, for another try
+	Trim string
+}
+
+// redactDetectors are the built-in patterns, by detector name
+var redactDetectors = map[string][]redactPattern{
+	"email": {
+		{Regex: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	},
+	"ipv4": {
+		{Regex: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`)},
+	},
+	"ipv6": {
+		{Regex: regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}(?:[0-9a-f]{0,4}|[0-9]{1,3}(?:\.[0-9]{1,3}){3})`), Valid: validIPv6, Trim: ":"},
+	},
+	"credit_card": {
+		{Regex: regexp.MustCompile(`\b[0-9](?:[ -]?[0-9]){12,18}\b`), Valid: validLuhn},
+	},
+	"bearer_token": {
+		{Regex: regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`)},
+	},
+	"aws_key": {
+		{Regex: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Regex: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})`)},
+	},
+}
+
+// redactor masks or hashes sensitive data in metric data and tags
+type redactor struct {
+	Patterns []redactPattern
+	Mask     string
+	HashKey  []byte
+	Tags     bool
+}
+
+func compileRedactor(from interface{}) (*redactor, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be a dict, not a %T", decoded)
+	}
+
+	r := &redactor{Mask: defaultRedactMask, Tags: true}
+
+	if iDetectors, ok := rawCfg[configRedactDetectors]; ok {
+		rawDetectors, ok := iDetectors.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be a list, not a %T", configRedactDetectors, iDetectors)
+		}
+		for _, iDetector := range rawDetectors {
+			detector, _ := iDetector.(string)
+			patterns, ok := redactDetectors[detector]
+			if !ok {
+				return nil, fmt.Errorf("Unknown detector %v", iDetector)
+			}
+			r.Patterns = append(r.Patterns, patterns...)
+		}
+	}
+
+	if iPatterns, ok := rawCfg[configRedactPatterns]; ok {
+		rawPatterns, ok := iPatterns.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be a list, not a %T", configRedactPatterns, iPatterns)
+		}
+		regexes, err := compileRegexes(rawPatterns)
+		if err != nil {
+			return nil, err
+		}
+		for _, regex := range regexes {
+			r.Patterns = append(r.Patterns, redactPattern{Regex: regex})
+		}
+	}
+
+	if len(r.Patterns) == 0 {
+		return nil, fmt.Errorf("Must have at least one of %v or %v", configRedactDetectors, configRedactPatterns)
+	}
+
+	if iMask, ok := rawCfg[configRedactMask]; ok {
+		r.Mask, ok = iMask.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a string, not a %T", configRedactMask, iMask)
+		}
+	}
+	if iHashKey, ok := rawCfg[configRedactHashKey]; ok {
+		hashKey, ok := iHashKey.(string)
+		if !ok || hashKey == "" {
+			return nil, fmt.Errorf("%v must be a non-empty string", configRedactHashKey)
+		}
+		r.HashKey = []byte(hashKey)
+	}
+	if iTags, ok := rawCfg[configRedactTags]; ok {
+		r.Tags, ok = iTags.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a bool, not a %T", configRedactTags, iTags)
+		}
+	}
+	return r, nil
+}
+
+// replacement is what a piece of sensitive data is replaced with:
+// a keyed hash, so equal values can still be correlated, or the mask
+func (r *redactor) replacement(secret string) string {
+	if r.HashKey == nil {
+		return r.Mask
+	}
+	mac := hmac.New(sha256.New, r.HashKey)
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))[:redactHashLength]
+}
+
+// redactString replaces everything the patterns find in str
+func (r *redactor) redactString(str string) string {
+	for _, pattern := range r.Patterns {
+		secretGroup := 0
+		for i, name := range pattern.Regex.SubexpNames() {
+			if name == redactSecretGroup {
+				secretGroup = i
+			}
+		}
+
+		var redacted []string
+		last := 0
+		for _, loc := range pattern.Regex.FindAllStringSubmatchIndex(str, -1) {
+			start, end := loc[2*secretGroup], loc[2*secretGroup+1]
+			if start < 0 {
+				continue
+			}
+			secret := str[start:end]
+			if pattern.Valid != nil && !pattern.Valid(secret) {
+				// The regex can take in the punctuation after
+				// the secret, as in "2001:db8::1: timeout"
+				secret = strings.TrimRight(secret, pattern.Trim)
+				if pattern.Trim == "" || !pattern.Valid(secret) {
+					continue
+				}
+				end = start + len(secret)
+			}
+			redacted = append(redacted, str[last:start], r.replacement(secret))
+			last = end
+		}
+		if redacted != nil {
+			str = strings.Join(append(redacted, str[last:]), "")
+		}
+	}
+	return str
+}
+
+// redact returns the metric with its string or byte data and, if
+// enabled, its tag values redacted
+func (r *redactor) redact(metric plugin.Metric) plugin.Metric {
+	switch data := metric.Data.(type) {
+	case string:
+		metric.Data = r.redactString(data)
+	case []byte:
+		metric.Data = []byte(r.redactString(string(data)))
+	}
+	if !r.Tags || len(metric.Tags) == 0 {
+		return metric
+	}
+	// The tags may be shared with other
+	// metrics, so edit a copy
+	tags := make(map[string]string, len(metric.Tags))
+	for tag, value := range metric.Tags {
+		tags[tag] = r.redactString(value)
+	}
+	metric.Tags = tags
+	return metric
+}
+
+func validIPv6(candidate string) bool {
+	return strings.Contains(candidate, ":") && net.ParseIP(candidate) != nil
+}
+
+// validLuhn checks the Luhn checksum of a card number,
+// ignoring spaces and dashes
+func validLuhn(candidate string) bool {
+	sum := 0
+	digits := 0
+	double := false
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
@@ -0,0 +1,312 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configTests         = "tests"
+	configTestName      = "name"
+	configTestNamespace = "namespace"
+	configTestData      = "data"
+	configTestTags      = "tags"
+	configTestExpect    = "expect"
+	configTestCount     = "count"
+)
+
+var defaultTestNamespace = []string{"intel", "logs", "message"}
+
+// ruleTest is a test case declared alongside a gate: a metric to
+// run through the gate, and what should come out
+type ruleTest struct {
+	Name      string
+	Namespace []string
+	Data      interface{}
+	Tags      map[string]string
+	// Count is the number of metrics expected
+	Count  int
+	Expect []expectedMetric
+}
+
+// expectedMetric is what a metric out of a rule test should be;
+// the parts left nil aren't checked
+type expectedMetric struct {
+	Namespace []string
+	Data      interface{}
+	Tags      map[string]string
+}
+
+// RuleTestResult is the outcome of a test declared alongside a gate
+type RuleTestResult struct {
+	Gate string
+	Name string
+	// Diffs describe how the output differed from what was
+	// expected; a test with no diffs passed
+	Diffs []string
+}
+
+// Passed reports whether the test passed
+func (r RuleTestResult) Passed() bool {
+	return len(r.Diffs) == 0
+}
+
+func compileRuleTests(from interface{}) ([]ruleTest, error) {
+	rawTests, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configTests, from)
+	}
+
+	var tests []ruleTest
+	for idx, iTest := range rawTests {
+		rawTest, ok := iTest.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Test %d must be a dict, not a %T", idx+1, iTest)
+		}
+		test, err := compileRuleTest(rawTest)
+		if err != nil {
+			return nil, fmt.Errorf("Test %d: %v", idx+1, err)
+		}
+		if test.Name == "" {
+			test.Name = fmt.Sprintf("test %d", idx+1)
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+func compileRuleTest(rawTest map[interface{}]interface{}) (ruleTest, error) {
+	var err error
+	test := ruleTest{Namespace: defaultTestNamespace}
+
+	if iName, ok := rawTest[configTestName]; ok {
+		test.Name, ok = iName.(string)
+		if !ok {
+			return test, fmt.Errorf("%v must be a string, not a %T", configTestName, iName)
+		}
+	}
+
+	var ok bool
+	test.Data, ok = rawTest[configTestData]
+	if !ok || test.Data == nil {
+		return test, fmt.Errorf("%v is required", configTestData)
+	}
+	if iNamespace, ok := rawTest[configTestNamespace]; ok {
+		test.Namespace, err = compileNamespace(iNamespace)
+		if err != nil {
+			return test, fmt.Errorf("%v: %v", configTestNamespace, err)
+		}
+	}
+	test.Tags = map[string]string{}
+	if iTags, ok := rawTest[configTestTags]; ok {
+		test.Tags, err = compileTestTags(iTags)
+		if err != nil {
+			return test, err
+		}
+	}
+
+	iExpect, hasExpect := rawTest[configTestExpect]
+	if hasExpect {
+		rawExpect, ok := iExpect.([]interface{})
+		if !ok {
+			return test, fmt.Errorf("%v must be a list of metrics, not a %T", configTestExpect, iExpect)
+		}
+		for idx, iMetric := range rawExpect {
+			expected, err := compileExpectedMetric(iMetric)
+			if err != nil {
+				return test, fmt.Errorf("%v metric %d: %v", configTestExpect, idx+1, err)
+			}
+			test.Expect = append(test.Expect, expected)
+		}
+		test.Count = len(test.Expect)
+	}
+	if iCount, ok := rawTest[configTestCount]; ok {
+		test.Count, err = configInt(iCount)
+		if err != nil || test.Count < 0 {
+			return test, fmt.Errorf("%v must be a number of metrics, not %v", configTestCount, iCount)
+		}
+		if hasExpect && test.Count < len(test.Expect) {
+			return test, fmt.Errorf("%v is less than the %d metrics expected", configTestCount, len(test.Expect))
+		}
+	} else if !hasExpect {
+		return test, fmt.Errorf("Needs %v or %v", configTestExpect, configTestCount)
+	}
+	return test, nil
+}
+
+func compileExpectedMetric(from interface{}) (expectedMetric, error) {
+	var err error
+	var expected expectedMetric
+	rawMetric, ok := from.(map[interface{}]interface{})
+	if !ok {
+		return expected, fmt.Errorf("Must be a dict, not a %T", from)
+	}
+	if iNamespace, ok := rawMetric[configTestNamespace]; ok {
+		expected.Namespace, err = compileNamespace(iNamespace)
+		if err != nil {
+			return expected, fmt.Errorf("%v: %v", configTestNamespace, err)
+		}
+	}
+	expected.Data = rawMetric[configTestData]
+	if iTags, ok := rawMetric[configTestTags]; ok {
+		expected.Tags, err = compileTestTags(iTags)
+		if err != nil {
+			return expected, err
+		}
+	}
+	return expected, nil
+}
+
+// compileTestTags reads a dict of tags, whose values may be
+// written as numbers or booleans
+func compileTestTags(from interface{}) (map[string]string, error) {
+	rawTags, ok := from.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a dict, not a %T", configTestTags, from)
+	}
+	tags := make(map[string]string, len(rawTags))
+	for iTag, iValue := range rawTags {
+		tag, ok := iTag.(string)
+		if !ok {
+			return nil, fmt.Errorf("Tag names must be strings, not a %T with value %v", iTag, iTag)
+		}
+		if iValue == nil {
+			iValue = ""
+		}
+		tags[tag] = fmt.Sprint(iValue)
+	}
+	return tags, nil
+}
+
+// RunRuleTests runs the tests declared alongside the gates. Each test
+// runs through its own gate only, with a fresh plugin, and the plugin
+// wide settings of the config.
+func RunRuleTests(cfg plugin.Config) ([]RuleTestResult, error) {
+	pluginCfg, err := parseConfig(cfg, newFileCache())
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RuleTestResult
+	for _, gate := range pluginCfg.Gates {
+		gateCfg := *pluginCfg
+		gateCfg.Gates = []internalConfig{gate}
+		gateCfg.SelfMetrics = nil
+		for _, test := range gate.Tests {
+			results = append(results, RuleTestResult{
+				Gate:  gate.Name,
+				Name:  test.Name,
+				Diffs: test.run(&gateCfg),
+			})
+		}
+	}
+	return results, nil
+}
+
+// run runs the test, returning how the output differed from what
+// was expected
+func (t ruleTest) run(pluginCfg *pluginConfig) []string {
+	tags := make(map[string]string, len(t.Tags))
+	for k, v := range t.Tags {
+		tags[k] = v
+	}
+	input := plugin.Metric{
+		Namespace: plugin.NewNamespace(t.Namespace...),
+		Timestamp: time.Now(),
+		Tags:      tags,
+		Data:      t.Data,
+	}
+	p := New()
+	output, err := p.process([]plugin.Metric{input}, pluginCfg)
+	if err != nil {
+		return []string{fmt.Sprintf("Process failed: %v", err)}
+	}
+	// Nothing else is coming, so what's held back comes out too
+	output = append(output, p.flush(pluginCfg)...)
+
+	var diffs []string
+	if len(output) != t.Count {
+		diffs = append(diffs, fmt.Sprintf("count: expected %d metrics, got %d", t.Count, len(output)))
+	}
+	for idx, expected := range t.Expect {
+		if idx >= len(output) {
+			break
+		}
+		diffs = append(diffs, expected.diff(idx+1, output[idx])...)
+	}
+	return diffs
+}
+
+// diff returns how the metric differs from what was expected
+func (e expectedMetric) diff(num int, m plugin.Metric) []string {
+	var diffs []string
+	if e.Namespace != nil {
+		expected := "/" + strings.Join(e.Namespace, "/")
+		got := "/" + strings.Join(m.Namespace.Strings(), "/")
+		if expected != got {
+			diffs = append(diffs, fmt.Sprintf("metric %d namespace: expected %v, got %v", num, expected, got))
+		}
+	}
+	if e.Data != nil && fmt.Sprint(e.Data) != fmt.Sprint(m.Data) {
+		diffs = append(diffs, fmt.Sprintf("metric %d data: expected %q, got %q", num, fmt.Sprint(e.Data), fmt.Sprint(m.Data)))
+	}
+	if e.Tags != nil {
+		if tagDiff := diffTags(e.Tags, m.Tags); tagDiff != nil {
+			diffs = append(diffs, fmt.Sprintf("metric %d tags:\n%v", num, strings.Join(tagDiff, "\n")))
+		}
+	}
+	return diffs
+}
+
+// diffTags returns the tags expected but missing or different,
+// prefixed with "-", and those got instead, prefixed with "+"
+func diffTags(expected map[string]string, got map[string]string) []string {
+	var names []string
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		expectedValue, inExpected := expected[name]
+		gotValue, inGot := got[name]
+		if inExpected && inGot && expectedValue == gotValue {
+			continue
+		}
+		if inExpected {
+			lines = append(lines, fmt.Sprintf("  - %v: %q", name, expectedValue))
+		}
+		if inGot {
+			lines = append(lines, fmt.Sprintf("  + %v: %q", name, gotValue))
+		}
+	}
+	return lines
+}
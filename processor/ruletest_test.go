@@ -0,0 +1,157 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRuleTests(t *testing.T) {
+	Convey("Test rule tests", t, func() {
+		Convey("pass when the output is as expected", func() {
+			results, err := RunRuleTests(plugin.Config{
+				configGateTag: "gate",
+				configGates: `
+- name: requests
+  match: "^GET "
+  split: [';']
+  parse: ['^GET (?P<path>\S+) (?P<status>[0-9]+)$']
+  tests:
+    - name: two requests
+      data: "GET /a 200;GET /b 500"
+      tags: {host: web1}
+      expect:
+        - data: "GET /a 200"
+          tags: {host: web1, path: /a, status: 200, gate: requests}
+        - namespace: /intel/logs/message
+          tags: {host: web1, path: /b, status: 500, gate: requests}
+    - data: "POST /a"
+      count: 1
+- name: other
+  match: "^POST "
+  parse: ['(?P<method>POST)']
+`,
+			})
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Gate, ShouldEqual, "requests")
+			So(results[0].Name, ShouldEqual, "two requests")
+			So(results[0].Diffs, ShouldBeEmpty)
+			So(results[0].Passed(), ShouldBeTrue)
+			// Other gates don't see the test metrics
+			So(results[1].Name, ShouldEqual, "test 2")
+			So(results[1].Passed(), ShouldBeTrue)
+		})
+
+		Convey("report the differences when it isn't", func() {
+			results, err := RunRuleTests(plugin.Config{
+				"^GET ": `
+parse: ['^GET (?P<path>\S+) (?P<status>[0-9]+)$']
+tests:
+  - data: "GET /a 200"
+    expect:
+      - namespace: /intel/logs/access
+        data: "GET /a 201"
+        tags: {path: /a, status: 201, extra: x}
+  - data: "GET /a 200"
+    count: 2
+`,
+			})
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Passed(), ShouldBeFalse)
+			So(results[0].Diffs, ShouldResemble, []string{
+				"metric 1 namespace: expected /intel/logs/access, got /intel/logs/message",
+				`metric 1 data: expected "GET /a 201", got "GET /a 200"`,
+				"metric 1 tags:\n" +
+					`  - extra: "x"` + "\n" +
+					`  - status: "201"` + "\n" +
+					`  + status: "200"`,
+			})
+			So(results[1].Diffs, ShouldResemble, []string{"count: expected 2 metrics, got 1"})
+		})
+
+		Convey("see what gates hold back", func() {
+			results, err := RunRuleTests(plugin.Config{
+				configGates: `
+- name: links
+  match: "^link"
+  parse: ['^link (?P<state>\S+)']
+  dedup: true
+  tests:
+    - data: "link down"
+      expect:
+        - tags: {state: down, repeat_count: 1}
+- name: took
+  match: "took"
+  parse: ['took (?P<ms>[0-9]+)ms']
+  aggregate: {value: ms, stats: [max]}
+  tests:
+    - data: "took 5ms"
+      expect:
+        - namespace: /regexp-engine/aggregate/ms/max
+          tags: {gate: took}
+`,
+			})
+			So(err, ShouldBeNil)
+			So(results, ShouldHaveLength, 2)
+			So(results[0].Diffs, ShouldBeEmpty)
+			So(results[1].Diffs, ShouldBeEmpty)
+		})
+
+		Convey("report Process failures", func() {
+			results, err := RunRuleTests(plugin.Config{
+				"^GET ": `
+parse: ['(?P<method>POST)']
+parse_mode: all_required
+on_error: fail_batch
+tests:
+  - data: "GET /a 200"
+    count: 0
+`,
+			})
+			So(err, ShouldBeNil)
+			So(results[0].Diffs, ShouldHaveLength, 1)
+			So(results[0].Diffs[0], ShouldStartWith, "Process failed: ")
+		})
+
+		Convey("are checked when the config is parsed", func() {
+			for _, tests := range []string{
+				`nope`,
+				`[nope]`,
+				`[{count: 1}]`,
+				`[{data: x}]`,
+				`[{data: x, expect: nope}]`,
+				`[{data: x, expect: [{}, {}], count: 1}]`,
+				`[{data: x, count: -1}]`,
+				`[{data: x, count: 1, tags: [a]}]`,
+			} {
+				_, err := New().Process(nil, plugin.Config{
+					"^GET ": `{parse: ['(?P<x>GET)'], tests: ` + tests + `}`,
+				})
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
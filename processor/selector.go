@@ -0,0 +1,136 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const namespaceWildcard = "*"
+
+// namespaceSelector is a Snap-style namespace pattern such as
+// /intel/logs/*/message. A "*" element matches any single element,
+// and a trailing "*" also matches everything below it, just like
+// the metric selectors in a task manifest.
+type namespaceSelector []string
+
+// tagSelectors maps tag names to the regex their value must match
+type tagSelectors map[string]*regexp.Regexp
+
+func compileNamespaceSelectors(from interface{}) ([]namespaceSelector, error) {
+	var raw []interface{}
+	switch v := from.(type) {
+	case string:
+		raw = []interface{}{v}
+	case []interface{}:
+		raw = v
+	default:
+		return nil, fmt.Errorf("Namespace selector must be a string or a list, not a %T with value %v", from, from)
+	}
+
+	var selectors []namespaceSelector
+	for _, iPattern := range raw {
+		pattern, ok := iPattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("Namespace selector not a string but %T with value %v", iPattern, iPattern)
+		}
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("Namespace selector can't be empty")
+		}
+		selectors = append(selectors, namespaceSelector(strings.Split(pattern, "/")))
+	}
+	return selectors, nil
+}
+
+func compileTagSelectors(from interface{}) (tagSelectors, error) {
+	raw, ok := from.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Tag selectors must be a dict, not a %T with value %v", from, from)
+	}
+
+	selectors := make(tagSelectors, len(raw))
+	for iTag, iExpr := range raw {
+		tag, ok := iTag.(string)
+		if !ok {
+			return nil, fmt.Errorf("Tag isn't a string, but a %T with value %v", iTag, iTag)
+		}
+		expr, ok := iExpr.(string)
+		if !ok {
+			return nil, fmt.Errorf("Tag selector for %v not a string but %T with value %v", tag, iExpr, iExpr)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		selectors[tag] = regex
+	}
+	return selectors, nil
+}
+
+func (s namespaceSelector) matches(ns plugin.Namespace) bool {
+	elements := ns.Strings()
+	for idx, want := range s {
+		if idx >= len(elements) {
+			return false
+		}
+		if want == namespaceWildcard {
+			if idx == len(s)-1 {
+				return true
+			}
+			continue
+		}
+		if want != elements[idx] {
+			return false
+		}
+	}
+	return len(elements) == len(s)
+}
+
+func (s tagSelectors) matches(tags map[string]string) bool {
+	for tag, regex := range s {
+		value, ok := tags[tag]
+		if !ok || !regex.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// selects reports whether the metric passes the namespace and tag
+// selectors of a gate; no selectors means every metric is selected
+func (c internalConfig) selects(metric plugin.Metric) bool {
+	if len(c.Namespaces) > 0 {
+		selected := false
+		for _, selector := range c.Namespaces {
+			if selector.matches(metric.Namespace) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return false
+		}
+	}
+	return c.Tags.matches(metric.Tags)
+}
@@ -0,0 +1,109 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestNamespaceSelector(t *testing.T) {
+	Convey("Compile and match namespace selectors", t, func() {
+		selectors, err := compileNamespaceSelectors([]interface{}{"/intel/logs/*/message", "/other/*"})
+		So(err, ShouldBeNil)
+		So(len(selectors), ShouldEqual, 2)
+
+		Convey("A wildcard matches exactly one element", func() {
+			So(selectors[0].matches(plugin.NewNamespace("intel", "logs", "nginx", "message")), ShouldBeTrue)
+			So(selectors[0].matches(plugin.NewNamespace("intel", "logs", "nginx", "error")), ShouldBeFalse)
+			So(selectors[0].matches(plugin.NewNamespace("intel", "logs", "nginx", "message", "x")), ShouldBeFalse)
+			So(selectors[0].matches(plugin.NewNamespace("intel", "logs", "message")), ShouldBeFalse)
+		})
+
+		Convey("A trailing wildcard matches everything below", func() {
+			So(selectors[1].matches(plugin.NewNamespace("other", "a")), ShouldBeTrue)
+			So(selectors[1].matches(plugin.NewNamespace("other", "a", "b", "c")), ShouldBeTrue)
+			So(selectors[1].matches(plugin.NewNamespace("other")), ShouldBeFalse)
+		})
+
+		Convey("Bad selectors are rejected", func() {
+			_, err := compileNamespaceSelectors(123)
+			So(err, ShouldNotBeNil)
+			_, err = compileNamespaceSelectors("/")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGateSelectors(t *testing.T) {
+	Convey("Test gates restricted by namespace and tags", t, func() {
+		newPlugin := New()
+		config := plugin.Config{}
+		var matchMap map[string]interface{} = make(map[string]interface{})
+		matchMap[configParseRegexp] = []string{`^feature (?P<feature_name>[A-Za-z0-9]*)$`}
+		matchMap[configNamespace] = []string{"/intel/logs/*/message"}
+		matchMap[configMatchTags] = map[string]string{"source": "^features?$"}
+		mmYaml, err := yaml.Marshal(matchMap)
+		So(err, ShouldBeNil)
+		config["^feature"] = string(mmYaml)
+
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "featurefile", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"source": "feature"},
+				Data:      "feature 1",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "featurefile", "other"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"source": "feature"},
+				Data:      "feature 2",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "featurefile", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"source": "syslog"},
+				Data:      "feature 3",
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "featurefile", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      123,
+			},
+		}
+
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 4)
+		So(metrics[0].Tags["feature_name"], ShouldEqual, "1")
+		Convey("Unselected metrics pass through untouched", func() {
+			So(metrics[1].Tags, ShouldNotContainKey, "feature_name")
+			So(metrics[2].Tags, ShouldNotContainKey, "feature_name")
+			So(metrics[3].Data, ShouldEqual, 123)
+		})
+	})
+}
@@ -0,0 +1,195 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configSelfMetricsNamespace = "namespace"
+
+	// Names of the self-monitoring metrics, after the namespace
+	statIn                   = "in"
+	statMatched              = "matched"
+	statSplit                = "split"
+	statMatchAgainDropped    = "match_again_dropped"
+	statParseFailures        = "parse_failures"
+	statTemplateErrors       = "template_errors"
+	statDeadLettered         = "dead_lettered"
+	statProcessingSeconds    = "processing_seconds"
+	statSampled              = "sampled"
+	statRateLimited          = "rate_limited"
+	statCardinalityOverflows = "cardinality_overflows"
+
+	// statTagTag names the tag a cardinality overflow count is for
+	statTagTag = "tag"
+)
+
+var defaultSelfMetricsNamespace = []string{Name, "stats"}
+
+// gateStats counts what a gate did
+type gateStats struct {
+	In                uint64
+	Matched           uint64
+	Split             uint64
+	MatchAgainDropped uint64
+	ParseFailures     uint64
+	TemplateErrors    uint64
+	DeadLettered      uint64
+	ProcessingTime    time.Duration
+}
+
+// selfMetrics holds the settings of the self-monitoring metrics
+type selfMetrics struct {
+	Namespace []string
+}
+
+// processorStats adds up the gates' stats across Process calls,
+// by config ID and gate name
+type processorStats struct {
+	sync.Mutex
+	configs map[string]map[string]*gateStats
+}
+
+func compileSelfMetrics(from interface{}) (*selfMetrics, error) {
+	s := &selfMetrics{Namespace: defaultSelfMetricsNamespace}
+	if enabled, ok := from.(bool); ok {
+		if !enabled {
+			return nil, nil
+		}
+		return s, nil
+	}
+
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be true or a dict, not a %T", decoded)
+	}
+	if iNamespace, ok := rawCfg[configSelfMetricsNamespace]; ok {
+		s.Namespace, err = compileNamespace(iNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configSelfMetricsNamespace, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *gateStats) add(other *gateStats) {
+	s.In += other.In
+	s.Matched += other.Matched
+	s.Split += other.Split
+	s.MatchAgainDropped += other.MatchAgainDropped
+	s.ParseFailures += other.ParseFailures
+	s.TemplateErrors += other.TemplateErrors
+	s.DeadLettered += other.DeadLettered
+	s.ProcessingTime += other.ProcessingTime
+}
+
+func newProcessorStats() *processorStats {
+	return &processorStats{configs: make(map[string]map[string]*gateStats)}
+}
+
+// add adds the stats of one Process call with the config,
+// by gate name
+func (p *processorStats) add(configID string, batch map[string]*gateStats) {
+	p.Lock()
+	defer p.Unlock()
+
+	gates, ok := p.configs[configID]
+	if !ok {
+		gates = make(map[string]*gateStats)
+		p.configs[configID] = gates
+	}
+	for name, stats := range batch {
+		total, ok := gates[name]
+		if !ok {
+			total = &gateStats{}
+			gates[name] = total
+		}
+		total.add(stats)
+	}
+}
+
+// metrics returns the self-monitoring metrics of the config: each
+// of its gates' stats and drops, and each guarded tag's overflows,
+// since the plugin started
+func (p *processorStats) metrics(configID string, s *selfMetrics, drops map[string]throttleDrops, overflows map[string]uint64, now time.Time) []plugin.Metric {
+	p.Lock()
+	defer p.Unlock()
+
+	metric := func(stat string, tags map[string]string, data interface{}) plugin.Metric {
+		namespace := append(append([]string{}, s.Namespace...), stat)
+		return plugin.Metric{
+			Namespace: plugin.NewNamespace(namespace...),
+			Timestamp: now,
+			Tags:      tags,
+			Data:      data,
+		}
+	}
+
+	gates := p.configs[configID]
+	var names []string
+	for name := range gates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mts []plugin.Metric
+	for _, name := range names {
+		stats := gates[name]
+		tags := func() map[string]string {
+			return map[string]string{counterGateTag: name}
+		}
+		mts = append(mts,
+			metric(statIn, tags(), stats.In),
+			metric(statMatched, tags(), stats.Matched),
+			metric(statSplit, tags(), stats.Split),
+			metric(statMatchAgainDropped, tags(), stats.MatchAgainDropped),
+			metric(statParseFailures, tags(), stats.ParseFailures),
+			metric(statTemplateErrors, tags(), stats.TemplateErrors),
+			metric(statDeadLettered, tags(), stats.DeadLettered),
+			metric(statProcessingSeconds, tags(), stats.ProcessingTime.Seconds()),
+		)
+		if gateDrops, ok := drops[name]; ok {
+			mts = append(mts,
+				metric(statSampled, tags(), gateDrops.Sampled),
+				metric(statRateLimited, tags(), gateDrops.RateLimited),
+			)
+		}
+	}
+
+	var tagNames []string
+	for tag := range overflows {
+		tagNames = append(tagNames, tag)
+	}
+	sort.Strings(tagNames)
+	for _, tag := range tagNames {
+		mts = append(mts, metric(statCardinalityOverflows, map[string]string{statTagTag: tag}, overflows[tag]))
+	}
+	return mts
+}
@@ -0,0 +1,130 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// statsByName returns the data of the self-monitoring metrics by
+// "gate/stat", or "tag/stat" for cardinality overflows
+func statsByName(mts []plugin.Metric, namespace []string) map[string]interface{} {
+	prefix := strings.Join(namespace, "/") + "/"
+	stats := map[string]interface{}{}
+	for _, m := range mts {
+		ns := strings.Join(m.Namespace.Strings(), "/")
+		if !strings.HasPrefix(ns, prefix) {
+			continue
+		}
+		owner := m.Tags[counterGateTag]
+		if owner == "" {
+			owner = m.Tags[statTagTag]
+		}
+		stats[owner+"/"+strings.TrimPrefix(ns, prefix)] = m.Data
+	}
+	return stats
+}
+
+func TestSelfMetrics(t *testing.T) {
+	var mts []plugin.Metric
+	for _, line := range []string{
+		"GET /a 200\nGET /b 500\nPOST /c",
+		"GET /d nope",
+		"unrelated",
+	} {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      map[string]string{},
+			Data:      line,
+		})
+	}
+
+	Convey("Test self-monitoring metrics", t, func() {
+		config := plugin.Config{
+			configSelfMetrics: `{namespace: /intel/regexp/stats}`,
+			configCardinality: `{limits: {path: 1}}`,
+			configGates: `
+- name: requests
+  match: "^GET "
+  split: ['\n']
+  parse: ['^GET (?P<path>\S+) (?P<status>[0-9]+)$']
+  tags:
+    bad: '{{ if eq .Tags.status "500" }}{{ .Nope.Nope }}{{ end }}'
+  parse_mode: all_required
+  parse_failure: tag
+`,
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(mts, config)
+		So(err, ShouldBeNil)
+
+		namespace := []string{"intel", "regexp", "stats"}
+		stats := statsByName(metrics, namespace)
+		So(stats["requests/"+statIn], ShouldEqual, 3)
+		So(stats["requests/"+statMatched], ShouldEqual, 2)
+		So(stats["requests/"+statSplit], ShouldEqual, 4)
+		So(stats["requests/"+statMatchAgainDropped], ShouldEqual, 1)
+		So(stats["requests/"+statParseFailures], ShouldEqual, 1)
+		So(stats["requests/"+statTemplateErrors], ShouldEqual, 1)
+		So(stats["requests/"+statProcessingSeconds], ShouldBeGreaterThan, 0)
+		So(stats, ShouldNotContainKey, "requests/"+statSampled)
+		So(stats["path/"+statCardinalityOverflows], ShouldEqual, 0)
+
+		Convey("add up across Process calls", func() {
+			metrics, err := newPlugin.Process(mts, config)
+			So(err, ShouldBeNil)
+			stats := statsByName(metrics, namespace)
+			So(stats["requests/"+statIn], ShouldEqual, 6)
+			So(stats["requests/"+statTemplateErrors], ShouldEqual, 2)
+		})
+
+		Convey("kept to each task", func() {
+			other := plugin.Config{
+				configSelfMetrics: `{namespace: /intel/regexp/stats}`,
+				configGates:       `[{name: posts, match: "^POST ", parse: ['(?P<method>POST)']}]`,
+			}
+			metrics, err := newPlugin.Process(mts, other)
+			So(err, ShouldBeNil)
+			stats := statsByName(metrics, namespace)
+			So(stats["posts/"+statIn], ShouldEqual, 3)
+			So(stats, ShouldNotContainKey, "requests/"+statIn)
+			So(stats, ShouldNotContainKey, "path/"+statCardinalityOverflows)
+		})
+	})
+
+	Convey("Test self-monitoring metrics are off by default", t, func() {
+		metrics, err := New().Process(mts, plugin.Config{"^GET": `{parse: ['(?P<x>GET)']}`})
+		So(err, ShouldBeNil)
+		So(statsByName(metrics, defaultSelfMetricsNamespace), ShouldBeEmpty)
+
+		s, err := compileSelfMetrics(true)
+		So(err, ShouldBeNil)
+		So(s.Namespace, ShouldResemble, defaultSelfMetricsNamespace)
+		_, err = compileSelfMetrics("[1, 2]")
+		So(err, ShouldNotBeNil)
+	})
+}
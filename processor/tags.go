@@ -0,0 +1,163 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagMatcher matches tag names exactly, or by regex for
+// entries written between slashes like /^tmp_/
+type tagMatcher struct {
+	Names   map[string]bool
+	Regexes []*regexp.Regexp
+}
+
+// tagEdits are the tag changes a gate makes after templating:
+// removing, then renaming, then keeping only the allowed tags
+type tagEdits struct {
+	Remove *tagMatcher
+	Rename map[string]string
+	Keep   *tagMatcher
+}
+
+func compileTagMatcher(from interface{}) (*tagMatcher, error) {
+	var raw []interface{}
+	switch v := from.(type) {
+	case string:
+		raw = []interface{}{v}
+	case []interface{}:
+		raw = v
+	default:
+		return nil, fmt.Errorf("Tag list must be a string or a list, not a %T with value %v", from, from)
+	}
+
+	matcher := &tagMatcher{Names: make(map[string]bool)}
+	for _, iEntry := range raw {
+		entry, ok := iEntry.(string)
+		if !ok {
+			return nil, fmt.Errorf("Tag list entry not a string but %T with value %v", iEntry, iEntry)
+		}
+		if len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			regex, err := regexp.Compile(entry[1 : len(entry)-1])
+			if err != nil {
+				return nil, err
+			}
+			matcher.Regexes = append(matcher.Regexes, regex)
+			continue
+		}
+		matcher.Names[entry] = true
+	}
+	return matcher, nil
+}
+
+// compileTagEdits reads the tag editing directives of a gate,
+// returning nil if it has none
+func compileTagEdits(rawGateCfg map[interface{}]interface{}) (*tagEdits, error) {
+	var err error
+	edits := &tagEdits{}
+	found := false
+
+	if iRemove, ok := rawGateCfg[configRemoveTags]; ok {
+		found = true
+		edits.Remove, err = compileTagMatcher(iRemove)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configRemoveTags, err)
+		}
+	}
+
+	if iRename, ok := rawGateCfg[configRenameTags]; ok {
+		found = true
+		rawRename, ok := iRename.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be a dict, not a %T", configRenameTags, iRename)
+		}
+		edits.Rename = make(map[string]string, len(rawRename))
+		for iFrom, iTo := range rawRename {
+			from, ok := iFrom.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v key isn't a string, but a %T with value %v", configRenameTags, iFrom, iFrom)
+			}
+			to, ok := iTo.(string)
+			if !ok || to == "" {
+				return nil, fmt.Errorf("%v of %v must be a non-empty string", configRenameTags, from)
+			}
+			edits.Rename[from] = to
+		}
+	}
+
+	if iKeep, ok := rawGateCfg[configKeepTags]; ok {
+		found = true
+		edits.Keep, err = compileTagMatcher(iKeep)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configKeepTags, err)
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return edits, nil
+}
+
+func (m *tagMatcher) matches(tag string) bool {
+	if m.Names[tag] {
+		return true
+	}
+	for _, regex := range m.Regexes {
+		if regex.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply edits the tags in place
+func (e *tagEdits) apply(tags map[string]string) {
+	if e.Remove != nil {
+		for tag := range tags {
+			if e.Remove.matches(tag) {
+				delete(tags, tag)
+			}
+		}
+	}
+
+	if e.Rename != nil {
+		renamed := make(map[string]string, len(e.Rename))
+		for from, to := range e.Rename {
+			if value, ok := tags[from]; ok {
+				renamed[to] = value
+				delete(tags, from)
+			}
+		}
+		for tag, value := range renamed {
+			tags[tag] = value
+		}
+	}
+
+	if e.Keep != nil {
+		for tag := range tags {
+			if !e.Keep.matches(tag) {
+				delete(tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTagEdits(t *testing.T) {
+	Convey("Test editing tags after templating", t, func() {
+		tags := map[string]string{
+			"plugin_running_on": "host1",
+			"tmp_a":             "a",
+			"tmp_b":             "b",
+			"status":            "200",
+			"path":              "/",
+		}
+
+		Convey("No directives means no edits", func() {
+			edits, err := compileTagEdits(map[interface{}]interface{}{})
+			So(err, ShouldBeNil)
+			So(edits, ShouldBeNil)
+		})
+
+		Convey("Tags are removed by name or regex, then renamed", func() {
+			edits, err := compileTagEdits(map[interface{}]interface{}{
+				configRemoveTags: []interface{}{"plugin_running_on", "/^tmp_/"},
+				configRenameTags: map[interface{}]interface{}{"status": "http_status", "missing": "other"},
+			})
+			So(err, ShouldBeNil)
+			edits.apply(tags)
+			So(tags, ShouldResemble, map[string]string{"http_status": "200", "path": "/"})
+		})
+
+		Convey("Keep only allows the listed tags, after renaming", func() {
+			edits, err := compileTagEdits(map[interface{}]interface{}{
+				configRenameTags: map[interface{}]interface{}{"status": "http_status"},
+				configKeepTags:   []interface{}{"http_status", "/^tmp_a$/"},
+			})
+			So(err, ShouldBeNil)
+			edits.apply(tags)
+			So(tags, ShouldResemble, map[string]string{"http_status": "200", "tmp_a": "a"})
+		})
+
+		Convey("Bad directives are rejected", func() {
+			_, err := compileTagEdits(map[interface{}]interface{}{configRemoveTags: 12})
+			So(err, ShouldNotBeNil)
+			_, err = compileTagEdits(map[interface{}]interface{}{configKeepTags: []interface{}{"/(/"}})
+			So(err, ShouldNotBeNil)
+			_, err = compileTagEdits(map[interface{}]interface{}{configRenameTags: map[interface{}]interface{}{"a": ""}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test tag edits on processed metrics", t, func() {
+		gateCfg := `
+parse:
+  - '^(?P<method>[A-Z]+) (?P<path>\S+) (?P<status>[0-9]+)'
+tags:
+  scratch: "{{ .Tags.method }} {{ .Tags.path }}"
+remove_tags:
+  - scratch
+  - /^collector_/
+rename_tags:
+  status: http_status
+`
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{"collector_host": "a", "source": "nginx"},
+				Data:      "GET / 200",
+			},
+		}
+		metrics, err := New().Process(mts, plugin.Config{"^[A-Z]+ ": gateCfg})
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Tags, ShouldNotContainKey, "scratch")
+		So(metrics[0].Tags, ShouldNotContainKey, "collector_host")
+		So(metrics[0].Tags, ShouldNotContainKey, "status")
+		So(metrics[0].Tags["http_status"], ShouldEqual, "200")
+		So(metrics[0].Tags["source"], ShouldEqual, "nginx")
+
+		Convey("The incoming metric's tags are left alone", func() {
+			So(mts[0].Tags, ShouldContainKey, "collector_host")
+		})
+	})
+}
@@ -0,0 +1,221 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configThrottleRate  = "rate"
+	configThrottleBy    = "by"
+	configThrottleBurst = "burst"
+)
+
+// gateSampling keeps a share of the metrics a gate emits, chosen
+// at random, or by a hash of the By tag so that all the metrics
+// with the same value are kept or dropped together
+type gateSampling struct {
+	Rate float64
+	By   string
+}
+
+// gateRateLimit keeps at most Rate metrics a second from a gate,
+// allowing bursts of up to Burst
+type gateRateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+// throttler holds the gates' rate limits between Process calls,
+// and counts what they dropped
+type throttler struct {
+	sync.Mutex
+	// buckets and dropped are by config ID, then gate name
+	buckets map[string]map[string]*tokenBucket
+	dropped map[string]map[string]*throttleDrops
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// throttleDrops counts the metrics a gate dropped
+type throttleDrops struct {
+	Sampled     uint64
+	RateLimited uint64
+}
+
+func compileGateSampling(from interface{}) (*gateSampling, error) {
+	s := &gateSampling{}
+	var iRate interface{}
+	switch v := from.(type) {
+	case map[interface{}]interface{}:
+		iRate = v[configThrottleRate]
+		if iBy, ok := v[configThrottleBy]; ok {
+			s.By, ok = iBy.(string)
+			if !ok || s.By == "" {
+				return nil, fmt.Errorf("%v %v must be a tag name, not %v", configSampleRate, configThrottleBy, iBy)
+			}
+		}
+	default:
+		iRate = v
+	}
+
+	rate, err := configFloat(iRate)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("%v must be between 0 and 1, not %v", configSampleRate, iRate)
+	}
+	s.Rate = rate
+	return s, nil
+}
+
+func compileGateRateLimit(from interface{}) (*gateRateLimit, error) {
+	r := &gateRateLimit{}
+	var iRate, iBurst interface{}
+	switch v := from.(type) {
+	case map[interface{}]interface{}:
+		iRate, iBurst = v[configThrottleRate], v[configThrottleBurst]
+	default:
+		iRate = v
+	}
+
+	rate, err := configFloat(iRate)
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("%v must be a positive number of metrics a second, not %v", configRateLimit, iRate)
+	}
+	r.Rate = rate
+	// By default, allow a second's worth at once
+	r.Burst = math.Max(rate, 1)
+	if iBurst != nil {
+		burst, err := configFloat(iBurst)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("%v %v must be at least 1, not %v", configRateLimit, configThrottleBurst, iBurst)
+		}
+		r.Burst = burst
+	}
+	return r, nil
+}
+
+// keeps reports whether a metric is in the sample
+func (s *gateSampling) keeps(m plugin.Metric) bool {
+	if s.By == "" {
+		return rand.Float64() < s.Rate
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(m.Tags[s.By]))
+	return float64(hash.Sum32()) < s.Rate*(1<<32)
+}
+
+func newThrottler() *throttler {
+	return &throttler{
+		buckets: make(map[string]map[string]*tokenBucket),
+		dropped: make(map[string]map[string]*throttleDrops),
+	}
+}
+
+// throttle returns the metrics emitted by a gate of the config with
+// the given ID that are within its sample and its rate limit
+func (t *throttler) throttle(configID string, gate internalConfig, metrics []plugin.Metric, now time.Time) []plugin.Metric {
+	t.Lock()
+	defer t.Unlock()
+
+	dropped, ok := t.dropped[configID]
+	if !ok {
+		dropped = make(map[string]*throttleDrops)
+		t.dropped[configID] = dropped
+	}
+	drops, ok := dropped[gate.Name]
+	if !ok {
+		drops = &throttleDrops{}
+		dropped[gate.Name] = drops
+	}
+
+	var kept []plugin.Metric
+	var rateLimited uint64
+	for _, m := range metrics {
+		if gate.Sampling != nil && !gate.Sampling.keeps(m) {
+			drops.Sampled++
+			continue
+		}
+		if gate.RateLimit != nil && !t.take(configID, gate.Name, gate.RateLimit, now) {
+			rateLimited++
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	if rateLimited > 0 {
+		drops.RateLimited += rateLimited
+		warnFields := map[string]interface{}{
+			"gate":    gate.Name,
+			"rate":    gate.RateLimit.Rate,
+			"burst":   gate.RateLimit.Burst,
+			"dropped": rateLimited,
+		}
+		log.WithFields(warnFields).Warn("Gate is over its rate limit, dropping metrics")
+	}
+	return kept
+}
+
+// take takes a token from the gate's bucket, if there's one
+func (t *throttler) take(configID, name string, limit *gateRateLimit, now time.Time) bool {
+	buckets, ok := t.buckets[configID]
+	if !ok {
+		buckets = make(map[string]*tokenBucket)
+		t.buckets[configID] = buckets
+	}
+	bucket, ok := buckets[name]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.Burst, last: now}
+		buckets[name] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(limit.Burst, bucket.tokens+elapsed*limit.Rate)
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// drops returns how many metrics each gate of the config
+// has dropped
+func (t *throttler) drops(configID string) map[string]throttleDrops {
+	t.Lock()
+	defer t.Unlock()
+
+	dropped := t.dropped[configID]
+	counts := make(map[string]throttleDrops, len(dropped))
+	for name, drops := range dropped {
+		counts[name] = *drops
+	}
+	return counts
+}
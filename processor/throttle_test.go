@@ -0,0 +1,155 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func throttleMetrics(n int) []plugin.Metric {
+	var mts []plugin.Metric
+	for i := 0; i < n; i++ {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      map[string]string{"request_id": fmt.Sprint(i)},
+			Data:      fmt.Sprintf("request %d", i),
+		})
+	}
+	return mts
+}
+
+// warnHook collects the warnings logged
+type warnHook struct {
+	entries []*log.Entry
+}
+
+func (h *warnHook) Levels() []log.Level {
+	return []log.Level{log.WarnLevel}
+}
+
+func (h *warnHook) Fire(e *log.Entry) error {
+	h.entries = append(h.entries, e)
+	return nil
+}
+
+func TestThrottling(t *testing.T) {
+	Convey("Test sampling", t, func() {
+		sampling, err := compileGateSampling(map[interface{}]interface{}{configThrottleRate: 0.25, configThrottleBy: "request_id"})
+		So(err, ShouldBeNil)
+		gate := internalConfig{Name: "requests", Sampling: sampling}
+		th := newThrottler()
+
+		mts := throttleMetrics(1000)
+		kept := th.throttle("task", gate, mts, time.Now())
+		So(len(kept), ShouldBeBetween, 150, 350)
+		So(th.drops("task")["requests"].Sampled, ShouldEqual, 1000-len(kept))
+
+		Convey("by a tag keeps the same metrics every time", func() {
+			So(th.throttle("task", gate, mts, time.Now()), ShouldResemble, kept)
+		})
+
+		Convey("at random", func() {
+			sampling, err := compileGateSampling(0.5)
+			So(err, ShouldBeNil)
+			So(sampling.By, ShouldEqual, "")
+			kept := th.throttle("task", internalConfig{Name: "random", Sampling: sampling}, mts, time.Now())
+			So(len(kept), ShouldBeBetween, 350, 650)
+		})
+
+		Convey("all or nothing", func() {
+			none, _ := compileGateSampling(0)
+			So(th.throttle("task", internalConfig{Name: "none", Sampling: none}, mts, time.Now()), ShouldBeEmpty)
+			all, _ := compileGateSampling("1")
+			So(len(th.throttle("task", internalConfig{Name: "all", Sampling: all}, mts, time.Now())), ShouldEqual, 1000)
+		})
+	})
+
+	Convey("Test rate limiting", t, func() {
+		limit, err := compileGateRateLimit(map[interface{}]interface{}{configThrottleRate: 10, configThrottleBurst: 20})
+		So(err, ShouldBeNil)
+		gate := internalConfig{Name: "noisy", RateLimit: limit}
+		th := newThrottler()
+		start := time.Now()
+
+		So(len(th.throttle("task", gate, throttleMetrics(50), start)), ShouldEqual, 20)
+		So(len(th.throttle("task", gate, throttleMetrics(50), start.Add(500*time.Millisecond))), ShouldEqual, 5)
+		So(len(th.throttle("task", gate, throttleMetrics(50), start.Add(time.Hour))), ShouldEqual, 20)
+		So(th.drops("task")["noisy"].RateLimited, ShouldEqual, 105)
+		So(th.drops("other"), ShouldBeEmpty)
+		So(len(th.throttle("other", gate, throttleMetrics(50), start)), ShouldEqual, 20)
+
+		Convey("warning each time it drops metrics", func() {
+			hook := &warnHook{}
+			hooks := log.StandardLogger().Hooks
+			log.StandardLogger().Hooks = make(log.LevelHooks)
+			log.AddHook(hook)
+			defer func() { log.StandardLogger().Hooks = hooks }()
+
+			th.throttle("task", gate, throttleMetrics(50), start.Add(2*time.Hour))
+			th.throttle("task", gate, throttleMetrics(1), start.Add(3*time.Hour))
+			th.throttle("task", gate, throttleMetrics(50), start.Add(4*time.Hour))
+			So(len(hook.entries), ShouldEqual, 2)
+			So(hook.entries[0].Data["dropped"], ShouldEqual, 30)
+			So(hook.entries[1].Data["gate"], ShouldEqual, "noisy")
+		})
+
+		limit, err = compileGateRateLimit(100)
+		So(err, ShouldBeNil)
+		So(limit.Burst, ShouldEqual, 100)
+	})
+
+	Convey("Test bad throttling configs are rejected", t, func() {
+		_, err := compileGateSampling(1.5)
+		So(err, ShouldNotBeNil)
+		_, err = compileGateSampling(map[interface{}]interface{}{configThrottleRate: 0.5, configThrottleBy: 3})
+		So(err, ShouldNotBeNil)
+		_, err = compileGateRateLimit(0)
+		So(err, ShouldNotBeNil)
+		_, err = compileGateRateLimit(map[interface{}]interface{}{configThrottleRate: 1, configThrottleBurst: 0})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test throttling in Process", t, func() {
+		config := plugin.Config{
+			"^request": `{parse: ['^request (?P<id>[0-9]+)'], rate_limit: {rate: 1, burst: 3}}`,
+		}
+		newPlugin := New()
+		metrics, err := newPlugin.Process(throttleMetrics(10), config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 3)
+
+		Convey("giving each task its own rate limit", func() {
+			other := plugin.Config{
+				"^request": `{parse: ['^request (?P<id>[0-9]+)'], rate_limit: {rate: 1, burst: 5}}`,
+			}
+			metrics, err := newPlugin.Process(throttleMetrics(10), other)
+			So(err, ShouldBeNil)
+			So(len(metrics), ShouldEqual, 5)
+		})
+	})
+}
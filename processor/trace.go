@@ -0,0 +1,145 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+)
+
+const (
+	configDebugMatch = "match"
+
+	// Stages a trace logs
+	traceStageGate       = "gate"
+	traceStageSplit      = "split"
+	traceStageMatchAgain = "match_again"
+	traceStageParseRule  = "parse_rule"
+	traceStageParse      = "parse"
+	traceStageTemplate   = "template"
+	traceStageError      = "error"
+	traceStageOutput     = "output"
+	traceStagePassed     = "passed"
+)
+
+// traceIDs numbers the traced metrics, so their trace can be
+// picked out of the log
+var traceIDs uint64
+
+// debugTrace holds the settings of the debug trace
+type debugTrace struct {
+	// Match, when set, limits the trace to the metrics
+	// whose data it matches
+	Match *regexp.Regexp
+}
+
+// metricTrace logs the trace of one metric; a nil metricTrace
+// logs nothing
+type metricTrace struct {
+	fields log.Fields
+}
+
+func compileDebugTrace(from interface{}) (*debugTrace, error) {
+	d := &debugTrace{}
+	if enabled, ok := from.(bool); ok {
+		if !enabled {
+			return nil, nil
+		}
+		return d, nil
+	}
+
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawCfg, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Must be true or a dict, not a %T", decoded)
+	}
+	if iMatch, ok := rawCfg[configDebugMatch]; ok {
+		expr, ok := iMatch.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v must be a regex, not a %T", configDebugMatch, iMatch)
+		}
+		d.Match, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configDebugMatch, err)
+		}
+	}
+	return d, nil
+}
+
+// start returns the trace of a metric, or nil if it isn't traced
+func (d *debugTrace) start(m plugin.Metric, data string) *metricTrace {
+	if d == nil {
+		return nil
+	}
+	if d.Match != nil && !d.Match.MatchString(data) {
+		return nil
+	}
+	return &metricTrace{fields: log.Fields{
+		"trace":     atomic.AddUint64(&traceIDs, 1),
+		"namespace": m.Namespace.Strings(),
+		"data":      m.Data,
+	}}
+}
+
+// log logs a stage of the trace
+func (t *metricTrace) log(stage string, fields log.Fields) {
+	if t == nil {
+		return
+	}
+	entry := log.WithFields(t.fields).WithField("stage", stage)
+	if fields != nil {
+		entry = entry.WithFields(fields)
+	}
+	entry.Info("Trace: " + stage)
+}
+
+// parseRules logs what each of the gate's parse rules captures
+// from a piece; the rules are run again, so only when tracing
+func (t *metricTrace) parseRules(gate internalConfig, piece string) {
+	if t == nil {
+		return
+	}
+	for _, rule := range gate.Parse {
+		fields := log.Fields{
+			"gate":     gate.Name,
+			"piece":    piece,
+			"regex":    rule.String(),
+			"required": rule.Required,
+		}
+		match := rule.Regex.FindStringSubmatch(piece)
+		fields["matched"] = match != nil
+		if match != nil {
+			captures := make(map[string]string)
+			for i, name := range rule.Regex.SubexpNames() {
+				if i != 0 && name != "" {
+					captures[name] = match[i]
+				}
+			}
+			fields["captures"] = captures
+		}
+		t.log(traceStageParseRule, fields)
+	}
+}
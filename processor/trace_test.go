@@ -0,0 +1,155 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// traceHook collects the trace entries logged
+type traceHook struct {
+	entries []*log.Entry
+}
+
+func (h *traceHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *traceHook) Fire(e *log.Entry) error {
+	if _, ok := e.Data["trace"]; ok {
+		h.entries = append(h.entries, e)
+	}
+	return nil
+}
+
+// stages returns the stage of each entry, in order
+func (h *traceHook) stages() []string {
+	var stages []string
+	for _, e := range h.entries {
+		stages = append(stages, e.Data["stage"].(string))
+	}
+	return stages
+}
+
+// captureTrace collects the trace entries logged by f
+func captureTrace(f func()) *traceHook {
+	hook := &traceHook{}
+	hooks := log.StandardLogger().Hooks
+	log.StandardLogger().Hooks = make(log.LevelHooks)
+	log.AddHook(hook)
+	defer func() { log.StandardLogger().Hooks = hooks }()
+	f()
+	return hook
+}
+
+func TestDebugTrace(t *testing.T) {
+	mts := []plugin.Metric{}
+	for _, line := range []string{"GET /a 200;GET /b 500", "unrelated"} {
+		mts = append(mts, plugin.Metric{
+			Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+			Timestamp: time.Now(),
+			Tags:      map[string]string{},
+			Data:      line,
+		})
+	}
+	gates := `
+- name: requests
+  match: "^GET "
+  split: [';']
+  parse: ['^GET (?P<path>\S+)', '(?P<status>[0-9]+)$']
+  tags:
+    route: '{{ .Tags.path }}'
+`
+
+	Convey("Test the debug trace", t, func() {
+		Convey("logs each stage of each metric", func() {
+			var err error
+			hook := captureTrace(func() {
+				_, err = New().Process(mts, plugin.Config{configDebug: true, configGates: gates})
+			})
+			So(err, ShouldBeNil)
+			So(hook.stages(), ShouldResemble, []string{
+				traceStageGate, traceStageSplit,
+				traceStageMatchAgain, traceStageParseRule, traceStageParseRule, traceStageParse, traceStageTemplate, traceStageOutput,
+				traceStageMatchAgain, traceStageParseRule, traceStageParseRule, traceStageParse, traceStageTemplate, traceStageOutput,
+				traceStageGate, traceStagePassed,
+			})
+
+			So(hook.entries[0].Data["matched"], ShouldBeTrue)
+			So(hook.entries[1].Data["pieces"], ShouldResemble, []interface{}{"GET /a 200", "GET /b 500"})
+			So(hook.entries[3].Data["captures"], ShouldResemble, map[string]string{"path": "/a"})
+			So(hook.entries[4].Data["captures"], ShouldResemble, map[string]string{"status": "200"})
+			So(hook.entries[6].Data["output"], ShouldResemble, map[string]string{"route": "/a"})
+			So(hook.entries[13].Data["tags"], ShouldResemble, map[string]string{"path": "/b", "status": "500", "route": "/b"})
+			So(hook.entries[14].Data["matched"], ShouldBeFalse)
+
+			// Entries of the same metric share its trace number
+			So(hook.entries[13].Data["trace"], ShouldEqual, hook.entries[0].Data["trace"])
+			So(hook.entries[15].Data["trace"], ShouldNotEqual, hook.entries[0].Data["trace"])
+		})
+
+		Convey("can be limited to matching metrics", func() {
+			var err error
+			hook := captureTrace(func() {
+				_, err = New().Process(mts, plugin.Config{configDebug: `{match: unrel}`, configGates: gates})
+			})
+			So(err, ShouldBeNil)
+			So(hook.stages(), ShouldResemble, []string{traceStageGate, traceStagePassed})
+			So(hook.entries[0].Data["data"], ShouldEqual, "unrelated")
+		})
+
+		Convey("logs the error policy applied", func() {
+			var err error
+			hook := captureTrace(func() {
+				_, err = New().Process(mts[:1], plugin.Config{
+					configDebug: true,
+					"^GET":      `{parse: ['(?P<method>POST)'], parse_mode: all_required, on_error: pass_original}`,
+				})
+			})
+			So(err, ShouldBeNil)
+			last := hook.entries[len(hook.entries)-1]
+			So(last.Data["stage"], ShouldEqual, traceStageError)
+			So(last.Data["policy"], ShouldEqual, errorPassOriginal)
+		})
+
+		Convey("is off by default", func() {
+			hook := captureTrace(func() {
+				New().Process(mts, plugin.Config{configGates: gates})
+			})
+			So(hook.entries, ShouldBeEmpty)
+		})
+
+		Convey("rejects bad settings", func() {
+			d, err := compileDebugTrace(false)
+			So(err, ShouldBeNil)
+			So(d, ShouldBeNil)
+			_, err = compileDebugTrace(`{match: "("}`)
+			So(err, ShouldNotBeNil)
+			_, err = compileDebugTrace("[1]")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
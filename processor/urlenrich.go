@@ -0,0 +1,205 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	configURLTag    = "tag"
+	configURLPrefix = "prefix"
+	configURLTags   = "tags"
+	configURLQuery  = "query"
+
+	// Tags set by URL decomposition, after the prefix
+	urlHostTag     = "host"
+	urlPathTag     = "path"
+	urlRouteTag    = "route"
+	urlFragmentTag = "fragment"
+	// Query parameters are set as query_<name>
+	urlQueryTag = "query"
+)
+
+// urlAllTags are the tags set when a url entry doesn't pick some
+var urlAllTags = []string{urlHostTag, urlPathTag, urlRouteTag, urlFragmentTag, urlQueryTag}
+
+// routePlaceholders replace the path segments that look like IDs
+// when normalizing a path into a route; the first match wins
+var routePlaceholders = []struct {
+	Regex       *regexp.Regexp
+	Placeholder string
+}{
+	{regexp.MustCompile(`^[0-9]+$`), "{id}"},
+	{regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`), "{uuid}"},
+	{regexp.MustCompile(`^(?i)[0-9a-f]{16,}$`), "{hash}"},
+}
+
+// gateURL decomposes the URL in the Tag tag, storing its parts
+// in tags starting with Prefix
+type gateURL struct {
+	Tag    string
+	Prefix string
+	// Tags are the parts to set
+	Tags map[string]bool
+	// Query are the only query parameters to set
+	Query []string
+}
+
+func compileGateURLs(from interface{}) ([]gateURL, error) {
+	rawEntries, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configURL, from)
+	}
+
+	var entries []gateURL
+	for _, iEntry := range rawEntries {
+		entry := gateURL{Tags: map[string]bool{}}
+		for _, tag := range urlAllTags {
+			entry.Tags[tag] = true
+		}
+		switch v := iEntry.(type) {
+		case string:
+			entry.Tag = v
+			entry.Prefix = v + "_"
+		case map[interface{}]interface{}:
+			entry.Tag, _ = v[configURLTag].(string)
+			entry.Prefix = entry.Tag + "_"
+			if iPrefix, ok := v[configURLPrefix]; ok {
+				entry.Prefix, ok = iPrefix.(string)
+				if !ok {
+					return nil, fmt.Errorf("%v %v must be a string, not a %T", configURL, configURLPrefix, iPrefix)
+				}
+			}
+			if iTags, ok := v[configURLTags]; ok {
+				tags, err := compileStringList(iTags)
+				if err != nil {
+					return nil, fmt.Errorf("%v %v: %v", configURL, configURLTags, err)
+				}
+				entry.Tags = map[string]bool{}
+				for _, tag := range tags {
+					if !isURLTag(tag) {
+						return nil, fmt.Errorf("%v %v must be some of %v, not %v", configURL, configURLTags, urlAllTags, tag)
+					}
+					entry.Tags[tag] = true
+				}
+			}
+			if iQuery, ok := v[configURLQuery]; ok {
+				var err error
+				entry.Query, err = compileStringList(iQuery)
+				if err != nil {
+					return nil, fmt.Errorf("%v %v: %v", configURL, configURLQuery, err)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%v entry not a string or a dict but %T with value %v", configURL, iEntry, iEntry)
+		}
+		if entry.Tag == "" {
+			return nil, fmt.Errorf("%v entry needs a %v", configURL, configURLTag)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func isURLTag(tag string) bool {
+	for _, urlTag := range urlAllTags {
+		if tag == urlTag {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRoute replaces the segments of a path that look like IDs
+// with placeholders, so that /users/42/posts/7 becomes
+// /users/{id}/posts/{id}
+func normalizeRoute(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		for _, placeholder := range routePlaceholders {
+			if placeholder.Regex.MatchString(segment) {
+				segments[i] = placeholder.Placeholder
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// decompose returns the tags describing a URL, without prefix
+func (g gateURL) decompose(rawURL string) (map[string]string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	path := parsed.Path
+	if path == "" && parsed.Opaque == "" {
+		path = "/"
+	}
+
+	tags := map[string]string{}
+	if g.Tags[urlHostTag] && parsed.Host != "" {
+		tags[urlHostTag] = parsed.Host
+	}
+	if g.Tags[urlPathTag] {
+		tags[urlPathTag] = path
+	}
+	if g.Tags[urlRouteTag] {
+		tags[urlRouteTag] = normalizeRoute(path)
+	}
+	if g.Tags[urlFragmentTag] && parsed.Fragment != "" {
+		tags[urlFragmentTag] = parsed.Fragment
+	}
+	if g.Tags[urlQueryTag] && len(g.Query) > 0 {
+		query := parsed.Query()
+		for _, param := range g.Query {
+			if values, ok := query[param]; ok {
+				tags[urlQueryTag+"_"+param] = strings.Join(values, ",")
+			}
+		}
+	}
+	return tags, nil
+}
+
+// apply sets the tags describing the URL in the entry's tag
+func (g gateURL) apply(tags map[string]string) {
+	rawURL, ok := tags[g.Tag]
+	if !ok || rawURL == "" || rawURL == "-" {
+		return
+	}
+	urlTags, err := g.decompose(rawURL)
+	if err != nil {
+		fields := map[string]interface{}{
+			"tag": g.Tag,
+			"url": rawURL,
+		}
+		log.WithFields(fields).Debug(err)
+		return
+	}
+	for tag, value := range urlTags {
+		tags[g.Prefix+tag] = value
+	}
+}
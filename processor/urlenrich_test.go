@@ -0,0 +1,106 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestURLDecomposition(t *testing.T) {
+	Convey("Test normalizing paths into routes", t, func() {
+		So(normalizeRoute("/users/42/posts/7"), ShouldEqual, "/users/{id}/posts/{id}")
+		So(normalizeRoute("/api/v2/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301"), ShouldEqual, "/api/v2/orders/{uuid}")
+		So(normalizeRoute("/blobs/0123456789abcdef0123"), ShouldEqual, "/blobs/{hash}")
+		So(normalizeRoute("/"), ShouldEqual, "/")
+	})
+
+	Convey("Test decomposing URLs", t, func() {
+		entries, err := compileGateURLs([]interface{}{
+			"request",
+			map[interface{}]interface{}{
+				configURLTag:    "referer",
+				configURLPrefix: "ref.",
+				configURLTags:   []interface{}{urlHostTag, urlQueryTag},
+				configURLQuery:  []interface{}{"q"},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 2)
+
+		tags, err := entries[0].decompose("/users/42/caf%C3%A9?page=2&token=secret#top")
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, map[string]string{
+			urlPathTag:     "/users/42/café",
+			urlRouteTag:    "/users/{id}/café",
+			urlFragmentTag: "top",
+		})
+
+		tags, err = entries[1].decompose("https://example.com/search?q=go&q=yaml&page=3")
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, map[string]string{
+			urlHostTag: "example.com",
+			"query_q":  "go,yaml",
+		})
+
+		Convey("Bad entries are rejected", func() {
+			_, err := compileGateURLs("request")
+			So(err, ShouldNotBeNil)
+			_, err = compileGateURLs([]interface{}{map[interface{}]interface{}{configURLPrefix: "x"}})
+			So(err, ShouldNotBeNil)
+			_, err = compileGateURLs([]interface{}{map[interface{}]interface{}{configURLTag: "x", configURLTags: []interface{}{"port"}}})
+			So(err, ShouldNotBeNil)
+			_, err = compileGateURLs([]interface{}{map[interface{}]interface{}{configURLTag: "x", configURLQuery: "page"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test URL decomposition in a gate", t, func() {
+		gateCfg := `
+parse:
+  - '^(?P<method>[A-Z]+) (?P<request>\S+)'
+url:
+  - tag: request
+    prefix: ""
+    tags: [route, query]
+    query: [page]
+`
+		config := plugin.Config{"^": gateCfg}
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      "GET /orders/123?page=4&session=abc 200",
+			},
+		}
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 1)
+		So(metrics[0].Tags["route"], ShouldEqual, "/orders/{id}")
+		So(metrics[0].Tags["query_page"], ShouldEqual, "4")
+		So(metrics[0].Tags, ShouldNotContainKey, "query_session")
+		So(metrics[0].Tags, ShouldNotContainKey, "path")
+	})
+}
@@ -0,0 +1,322 @@
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+const (
+	configUATag    = "tag"
+	configUAPrefix = "prefix"
+
+	configUARegex = "regex"
+	configUAName  = "name"
+	configUAType  = "type"
+
+	// Rule lists of a rule set
+	uaBots     = "bots"
+	uaBrowsers = "browsers"
+	uaOSes     = "oses"
+	uaDevices  = "devices"
+
+	// Capture groups rules can use
+	uaNameGroup    = "name"
+	uaVersionGroup = "version"
+
+	// Tags set by user agent enrichment, after the prefix
+	uaBrowserTag        = "browser"
+	uaBrowserVersionTag = "browser_version"
+	uaOSTag             = "os"
+	uaOSVersionTag      = "os_version"
+	uaDeviceTag         = "device"
+	uaBotTag            = "bot"
+
+	// Device types
+	uaDeviceBot     = "bot"
+	uaDeviceDesktop = "desktop"
+	uaDeviceMobile  = "mobile"
+	uaDeviceTablet  = "tablet"
+
+	// Value of tags we couldn't work out
+	uaUnknown = "other"
+)
+
+// defaultUserAgentRules is the rule set used unless useragent_rules
+// names a file. Within each list the first matching rule wins, so
+// more specific rules come first: Edge and Opera claim to be Chrome,
+// which claims to be Safari.
+const defaultUserAgentRules = `
+bots:
+  - regex: '(?i)(?P<name>googlebot|bingbot|slurp|duckduckbot|baiduspider|yandexbot|applebot|facebookexternalhit|twitterbot|linkedinbot|slackbot|ahrefsbot|semrushbot|petalbot|gptbot)'
+  - regex: '(?i)(?P<name>curl|wget|python-requests|python-urllib|go-http-client|java|okhttp|apache-httpclient|libwww-perl)(?:/(?P<version>[0-9.]+))?'
+  - regex: '(?i)(?P<name>[a-z0-9_-]*(?:bot|crawler|spider))\b'
+browsers:
+  - regex: 'Edg(?:e|A|iOS)?/(?P<version>[0-9.]+)'
+    name: Edge
+  - regex: '(?:OPR|Opera)/(?P<version>[0-9.]+)'
+    name: Opera
+  - regex: 'SamsungBrowser/(?P<version>[0-9.]+)'
+    name: Samsung Internet
+  - regex: '(?:Firefox|FxiOS)/(?P<version>[0-9.]+)'
+    name: Firefox
+  - regex: '(?:Chrome|CriOS)/(?P<version>[0-9.]+)'
+    name: Chrome
+  - regex: 'Version/(?P<version>[0-9.]+).*Safari/'
+    name: Safari
+  - regex: '(?:MSIE |Trident/.*rv:)(?P<version>[0-9.]+)'
+    name: Internet Explorer
+oses:
+  - regex: 'Windows NT (?P<version>[0-9.]+)'
+    name: Windows
+  - regex: '(?:iPhone|iPad|iPod).*OS (?P<version>[0-9_]+)'
+    name: iOS
+  - regex: 'Mac OS X (?P<version>[0-9_.]+)'
+    name: macOS
+  - regex: 'Android (?P<version>[0-9.]+)'
+    name: Android
+  - regex: 'CrOS'
+    name: Chrome OS
+  - regex: 'Linux'
+    name: Linux
+devices:
+  - regex: 'iPad|Tablet|Tab [0-9]|Nexus (?:7|9|10)'
+    type: tablet
+  - regex: 'Mobi|iPhone|iPod|Android.*Mobile|Windows Phone'
+    type: mobile
+  - regex: 'Android'
+    type: tablet
+`
+
+// uaRule is one rule of a user agent rule set; Name, if set,
+// stands in for a name capture
+type uaRule struct {
+	Regex *regexp.Regexp
+	Name  string
+}
+
+// userAgentParser finds browsers, operating systems, device
+// types and bots in user agent strings
+type userAgentParser struct {
+	Bots     []uaRule
+	Browsers []uaRule
+	OSes     []uaRule
+	Devices  []uaRule
+}
+
+// gateUserAgent parses the user agent in the Tag tag, storing what
+// it finds in tags starting with Prefix
+type gateUserAgent struct {
+	Tag    string
+	Prefix string
+	Parser *userAgentParser
+}
+
+var builtinUserAgentParser *userAgentParser
+
+func init() {
+	var err error
+	builtinUserAgentParser, err = compileUserAgentRules(defaultUserAgentRules)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// compileUserAgentParser returns the built-in parser, or the one
+// made from the rules file at path
+func compileUserAgentParser(from interface{}, files *fileCache) (*userAgentParser, error) {
+	if from == nil {
+		return builtinUserAgentParser, nil
+	}
+	path, ok := from.(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("%v must be a path, not %v", configUserAgentRules, from)
+	}
+	loaded, err := files.load("useragent", path, func(path string) (interface{}, error) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return compileUserAgentRules(string(content))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", configUserAgentRules, err)
+	}
+	return loaded.(*userAgentParser), nil
+}
+
+func compileUserAgentRules(from string) (*userAgentParser, error) {
+	decoded, err := decodeConfigValue(from)
+	if err != nil {
+		return nil, err
+	}
+	rawRules, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Rules must be a dict, not a %T", decoded)
+	}
+
+	parser := &userAgentParser{}
+	lists := map[string]*[]uaRule{
+		uaBots:     &parser.Bots,
+		uaBrowsers: &parser.Browsers,
+		uaOSes:     &parser.OSes,
+		uaDevices:  &parser.Devices,
+	}
+	for list, rules := range lists {
+		iRawList, ok := rawRules[list]
+		if !ok {
+			continue
+		}
+		rawList, ok := iRawList.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v must be a list, not a %T", list, iRawList)
+		}
+		for _, iRawRule := range rawList {
+			rawRule, ok := iRawRule.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%v rule must be a dict, not a %T", list, iRawRule)
+			}
+			expr, ok := rawRule[configUARegex].(string)
+			if !ok {
+				return nil, fmt.Errorf("%v rule %v has no %v", list, rawRule, configUARegex)
+			}
+			regex, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%v rule: %v", list, err)
+			}
+			rule := uaRule{Regex: regex}
+			if list == uaDevices {
+				rule.Name, _ = rawRule[configUAType].(string)
+			} else {
+				rule.Name, _ = rawRule[configUAName].(string)
+			}
+			*rules = append(*rules, rule)
+		}
+	}
+	return parser, nil
+}
+
+// matchUserAgentRules returns the name and version found by the first
+// matching rule
+func matchUserAgentRules(rules []uaRule, userAgent string) (string, string, bool) {
+	for _, rule := range rules {
+		match := rule.Regex.FindStringSubmatch(userAgent)
+		if match == nil {
+			continue
+		}
+		name, version := rule.Name, ""
+		for i, group := range rule.Regex.SubexpNames() {
+			switch group {
+			case uaNameGroup:
+				if name == "" {
+					name = match[i]
+				}
+			case uaVersionGroup:
+				version = match[i]
+			}
+		}
+		return name, version, true
+	}
+	return "", "", false
+}
+
+// parse returns the tags describing a user agent, without prefix
+func (p *userAgentParser) parse(userAgent string) map[string]string {
+	tags := map[string]string{
+		uaBrowserTag: uaUnknown,
+		uaOSTag:      uaUnknown,
+		uaDeviceTag:  uaDeviceDesktop,
+		uaBotTag:     strconv.FormatBool(false),
+	}
+
+	if name, version, ok := matchUserAgentRules(p.Bots, userAgent); ok {
+		tags[uaBotTag] = strconv.FormatBool(true)
+		tags[uaDeviceTag] = uaDeviceBot
+		tags[uaBrowserTag] = name
+		if version != "" {
+			tags[uaBrowserVersionTag] = version
+		}
+	} else if name, version, ok := matchUserAgentRules(p.Browsers, userAgent); ok {
+		tags[uaBrowserTag] = name
+		if version != "" {
+			tags[uaBrowserVersionTag] = version
+		}
+	}
+
+	if name, version, ok := matchUserAgentRules(p.OSes, userAgent); ok {
+		tags[uaOSTag] = name
+		if version != "" {
+			tags[uaOSVersionTag] = version
+		}
+	}
+
+	if tags[uaDeviceTag] != uaDeviceBot {
+		if device, _, ok := matchUserAgentRules(p.Devices, userAgent); ok {
+			tags[uaDeviceTag] = device
+		}
+	}
+	return tags
+}
+
+func compileGateUserAgent(from interface{}, parser *userAgentParser) ([]gateUserAgent, error) {
+	rawEntries, ok := from.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be a list, not a %T", configUserAgent, from)
+	}
+
+	var entries []gateUserAgent
+	for _, iEntry := range rawEntries {
+		entry := gateUserAgent{Parser: parser}
+		switch v := iEntry.(type) {
+		case string:
+			entry.Tag = v
+			entry.Prefix = v + "_"
+		case map[interface{}]interface{}:
+			entry.Tag, _ = v[configUATag].(string)
+			entry.Prefix = entry.Tag + "_"
+			if iPrefix, ok := v[configUAPrefix]; ok {
+				entry.Prefix, ok = iPrefix.(string)
+				if !ok {
+					return nil, fmt.Errorf("%v %v must be a string, not a %T", configUserAgent, configUAPrefix, iPrefix)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%v entry not a string or a dict but %T with value %v", configUserAgent, iEntry, iEntry)
+		}
+		if entry.Tag == "" {
+			return nil, fmt.Errorf("%v entry needs a %v", configUserAgent, configUATag)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// apply sets the tags describing the user agent in the entry's tag
+func (g gateUserAgent) apply(tags map[string]string) {
+	userAgent, ok := tags[g.Tag]
+	if !ok || userAgent == "" || userAgent == "-" {
+		return
+	}
+	for tag, value := range g.Parser.parse(userAgent) {
+		tags[g.Prefix+tag] = value
+	}
+}
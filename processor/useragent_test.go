@@ -0,0 +1,135 @@
+// +build small
+
+/*
+http://www.apache.org/licenses/LICENSE-2.0.txt
+
+Copyright 2016 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intelsdi-x/snap-plugin-lib-go/v1/plugin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUserAgentParsing(t *testing.T) {
+	Convey("Test parsing user agents with the built-in rules", t, func() {
+		parse := builtinUserAgentParser.parse
+
+		So(parse("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"), ShouldResemble, map[string]string{
+			uaBrowserTag:        "Chrome",
+			uaBrowserVersionTag: "120.0.0.0",
+			uaOSTag:             "Windows",
+			uaOSVersionTag:      "10.0",
+			uaDeviceTag:         uaDeviceDesktop,
+			uaBotTag:            "false",
+		})
+		So(parse("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91")[uaBrowserTag], ShouldEqual, "Edge")
+
+		iphone := parse("Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1")
+		So(iphone[uaBrowserTag], ShouldEqual, "Safari")
+		So(iphone[uaOSTag], ShouldEqual, "iOS")
+		So(iphone[uaOSVersionTag], ShouldEqual, "17_1")
+		So(iphone[uaDeviceTag], ShouldEqual, uaDeviceMobile)
+
+		tablet := parse("Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
+		So(tablet[uaOSTag], ShouldEqual, "Android")
+		So(tablet[uaDeviceTag], ShouldEqual, uaDeviceTablet)
+
+		bot := parse("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+		So(bot[uaBotTag], ShouldEqual, "true")
+		So(bot[uaDeviceTag], ShouldEqual, uaDeviceBot)
+		So(bot[uaBrowserTag], ShouldEqual, "Googlebot")
+
+		curl := parse("curl/8.4.0")
+		So(curl[uaBrowserTag], ShouldEqual, "curl")
+		So(curl[uaBrowserVersionTag], ShouldEqual, "8.4.0")
+		So(curl[uaBotTag], ShouldEqual, "true")
+
+		So(parse("something else")[uaBrowserTag], ShouldEqual, uaUnknown)
+	})
+
+	Convey("Test overriding the rules with a file", t, func() {
+		dir, err := ioutil.TempDir("", "regexp-engine-useragent")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		rules := filepath.Join(dir, "useragent.yaml")
+		So(ioutil.WriteFile(rules, []byte("browsers:\n  - regex: 'MyApp/(?P<version>\\S+)'\n    name: My App\n"), 0644), ShouldBeNil)
+
+		parser, err := compileUserAgentParser(rules, nil)
+		So(err, ShouldBeNil)
+		So(parser.parse("MyApp/1.2 (Windows NT 10.0)"), ShouldResemble, map[string]string{
+			uaBrowserTag:        "My App",
+			uaBrowserVersionTag: "1.2",
+			uaOSTag:             uaUnknown,
+			uaDeviceTag:         uaDeviceDesktop,
+			uaBotTag:            "false",
+		})
+
+		Convey("Bad rules are rejected", func() {
+			_, err := compileUserAgentParser(filepath.Join(dir, "missing.yaml"), nil)
+			So(err, ShouldNotBeNil)
+			_, err = compileUserAgentRules("browsers: [{regex: '('}]")
+			So(err, ShouldNotBeNil)
+			_, err = compileUserAgentRules("browsers: [{name: x}]")
+			So(err, ShouldNotBeNil)
+			_, err = compileUserAgentRules("oses: not a list")
+			So(err, ShouldNotBeNil)
+			_, err = compileGateUserAgent([]interface{}{map[interface{}]interface{}{configUAPrefix: "x"}}, parser)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test user agent parsing in a gate", t, func() {
+		gateCfg := `
+parse:
+  - '"(?P<agent>[^"]*)"$'
+useragent:
+  - tag: agent
+    prefix: "ua."
+`
+		config := plugin.Config{"^": gateCfg}
+		mts := []plugin.Metric{
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      `GET / 200 "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"`,
+			},
+			plugin.Metric{
+				Namespace: plugin.NewNamespace("intel", "logs", "metric", "log", "message"),
+				Timestamp: time.Now(),
+				Tags:      map[string]string{},
+				Data:      `GET / 200 "-"`,
+			},
+		}
+		metrics, err := New().Process(mts, config)
+		So(err, ShouldBeNil)
+		So(len(metrics), ShouldEqual, 2)
+		So(metrics[0].Tags["ua.browser"], ShouldEqual, "Firefox")
+		So(metrics[0].Tags["ua.browser_version"], ShouldEqual, "121.0")
+		So(metrics[0].Tags["ua.os"], ShouldEqual, "Linux")
+		So(metrics[0].Tags["ua.bot"], ShouldEqual, "false")
+		So(metrics[1].Tags, ShouldNotContainKey, "ua.browser")
+	})
+}
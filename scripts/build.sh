@@ -46,3 +46,6 @@ export GOOS=linux
 export GOARCH=amd64
 mkdir -p "${build_dir}/${GOOS}/x86_64"
 "${go_build[@]}" -o "${build_dir}/${GOOS}/x86_64/${plugin_name}" . || exit 1
+
+_info "building rules tool: regexp-engine-rules"
+"${go_build[@]}" -o "${build_dir}/${GOOS}/x86_64/regexp-engine-rules" ./cmd/regexp-engine-rules || exit 1